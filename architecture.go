@@ -1,12 +1,9 @@
 package main
 
 import (
-	"fmt"
 	"math/rand"
-	"time"
 
 	"github.com/fschuetz04/simgo"
-	"github.com/yaricom/goGraphML/graphml"
 )
 
 type (
@@ -20,11 +17,23 @@ const (
 	BackendNode  NodeType = "backend"
 	FrontendNode NodeType = "frontend"
 	DNSNode      NodeType = "dns"
-	AlarmNode    NodeType = "alarm"
+	LBNode       NodeType = "loadbalancer"
+	ClusterNode  NodeType = "cluster"
+	// Kubernetes nodes, pods and deployments
+	KubeNodeNode   NodeType = "k8snode"
+	PodNode        NodeType = "pod"
+	DeploymentNode NodeType = "deployment"
+	HypervisorNode NodeType = "hypervisor"
+	AlarmNode      NodeType = "alarm"
 
 	TriggerEdge    EdgeType = "trigger"
 	ConnectEdge    EdgeType = "connect"
 	DNSConnectEdge EdgeType = "DNSconnect"
+	MemberEdge     EdgeType = "member"
+	// ScheduledEdge link a pod with the node where it runs now
+	ScheduledEdge EdgeType = "scheduled"
+	// HostedEdge link a guest with the hypervisor where it runs now
+	HostedEdge EdgeType = "hosted"
 )
 
 // Architecture store the different servers of our application
@@ -33,19 +42,72 @@ type Architecture struct {
 	DBs       []*Database
 	Backends  []*Backend
 	Frontends []*Frontend
-	DNSs      []*DNS
+	// LoadBalancers distribute the requests between frontends
+	LoadBalancers []*LoadBalancer
+	DNSs          []*DNS
+	// Components are the servers whose behaviour is defined by a ComponentKind
+	Components []*Component
 	// Clusters almacena los grupos de servidores que deben estar unidos entre si.
 	// En el grafo se creará un link entre cada servidor y el resto de servidores
 	// del mismo cluster.
 	Clusters [][]ArchitectureServer
+	// QuorumClusters are the clusters with their own node in the graph and
+	// alarms for the cluster as a whole
+	QuorumClusters []*Cluster
+	// KubeNodes, Pods and Deployments are the Kubernetes workloads
+	KubeNodes   []*KubeNode
+	Pods        []*Pod
+	Deployments []*Deployment
+	// Hypervisors are the physical hosts of the servers that run as virtual machines
+	Hypervisors []*Hypervisor
 	// Monkeys are functions that will "sabotage" the architecture, triggering alarms
 	Monkeys []func(simgo.Process)
+	// Changes of the architecture scheduled during the simulation
+	Changes []*Change
+	// Incidents injected by the faults during the simulation
+	Incidents []*Incident
+	// Seed of the random generator used in the simulation. Two simulations of
+	// the same architecture with the same seed generate the same events.
+	Seed int64
+	// GraphOptions configure the graph exported with GraphML and CytoscapeJSON
+	GraphOptions GraphOptions
+
+	// incidentCount number of incidents generated by each fault, to generate the IDs
+	incidentCount map[string]int
+	// triggers is the number of times the faults have triggered alarms, and
+	// raisedBy the triggers still holding each alarm, the last one first
+	triggers int
+	raisedBy map[alarmKey][]raise
 
 	// mon connection to the monitoring system
 	mon MonitorSystem
 
 	// sim is the simulation object to use a fake time and make the simulation instant
 	sim *simgo.Simulation
+
+	// rand is the random generator of this architecture, created from Seed
+	rand *rand.Rand
+
+	// running are the servers with a Run process in the simulation
+	running map[MonitoredServer]bool
+	// history store when each node and edge of the graph existed, if the
+	// architecture has Changes
+	history *topologyHistory
+}
+
+// run start the Run process of the server in the simulation
+func (a *Architecture) run(server MonitoredServer) {
+	a.running[server] = true
+	a.sim.ProcessReflect(Run, server, a.Rand())
+}
+
+// Rand return the random generator of the architecture.
+// Everything random in the simulation should use it to be reproducible.
+func (a *Architecture) Rand() *rand.Rand {
+	if a.rand == nil {
+		a.rand = rand.New(rand.NewSource(a.Seed))
+	}
+	return a.rand
 }
 
 // Run start the monitoring of each server
@@ -53,36 +115,94 @@ func (a *Architecture) Start(sim_duration float64) {
 	a.sim = &simgo.Simulation{}
 
 	// Shuffle the servers to start in random order
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(a.Servers), func(i, j int) { a.Servers[i], a.Servers[j] = a.Servers[j], a.Servers[i] })
-	rand.Shuffle(len(a.DBs), func(i, j int) { a.DBs[i], a.DBs[j] = a.DBs[j], a.DBs[i] })
-	rand.Shuffle(len(a.Backends), func(i, j int) { a.Backends[i], a.Backends[j] = a.Backends[j], a.Backends[i] })
-	rand.Shuffle(len(a.Frontends), func(i, j int) { a.Frontends[i], a.Frontends[j] = a.Frontends[j], a.Frontends[i] })
-	rand.Shuffle(len(a.Monkeys), func(i, j int) { a.Monkeys[i], a.Monkeys[j] = a.Monkeys[j], a.Monkeys[i] })
-
+	r := a.Rand()
+	r.Shuffle(len(a.Servers), func(i, j int) { a.Servers[i], a.Servers[j] = a.Servers[j], a.Servers[i] })
+	r.Shuffle(len(a.DBs), func(i, j int) { a.DBs[i], a.DBs[j] = a.DBs[j], a.DBs[i] })
+	r.Shuffle(len(a.Backends), func(i, j int) { a.Backends[i], a.Backends[j] = a.Backends[j], a.Backends[i] })
+	r.Shuffle(len(a.Frontends), func(i, j int) { a.Frontends[i], a.Frontends[j] = a.Frontends[j], a.Frontends[i] })
+	r.Shuffle(len(a.DNSs), func(i, j int) { a.DNSs[i], a.DNSs[j] = a.DNSs[j], a.DNSs[i] })
+	r.Shuffle(len(a.LoadBalancers), func(i, j int) { a.LoadBalancers[i], a.LoadBalancers[j] = a.LoadBalancers[j], a.LoadBalancers[i] })
+	r.Shuffle(len(a.Components), func(i, j int) { a.Components[i], a.Components[j] = a.Components[j], a.Components[i] })
+	r.Shuffle(len(a.QuorumClusters), func(i, j int) { a.QuorumClusters[i], a.QuorumClusters[j] = a.QuorumClusters[j], a.QuorumClusters[i] })
+	r.Shuffle(len(a.KubeNodes), func(i, j int) { a.KubeNodes[i], a.KubeNodes[j] = a.KubeNodes[j], a.KubeNodes[i] })
+	r.Shuffle(len(a.Pods), func(i, j int) { a.Pods[i], a.Pods[j] = a.Pods[j], a.Pods[i] })
+	r.Shuffle(len(a.Deployments), func(i, j int) { a.Deployments[i], a.Deployments[j] = a.Deployments[j], a.Deployments[i] })
+	r.Shuffle(len(a.Hypervisors), func(i, j int) { a.Hypervisors[i], a.Hypervisors[j] = a.Hypervisors[j], a.Hypervisors[i] })
+	r.Shuffle(len(a.Monkeys), func(i, j int) { a.Monkeys[i], a.Monkeys[j] = a.Monkeys[j], a.Monkeys[i] })
+
+	a.running = make(map[MonitoredServer]bool)
 	for _, server := range a.Servers {
-		a.sim.ProcessReflect(Run, server)
+		a.run(server)
 	}
 
 	for _, db := range a.DBs {
-		a.sim.ProcessReflect(Run, db)
+		a.run(db)
 	}
 
 	for _, backend := range a.Backends {
-		a.sim.ProcessReflect(Run, backend)
+		a.run(backend)
 	}
 
 	for _, frontend := range a.Frontends {
-		a.sim.ProcessReflect(Run, frontend)
+		a.run(frontend)
+	}
+
+	for _, lb := range a.LoadBalancers {
+		a.run(lb)
+	}
+
+	for _, dns := range a.DNSs {
+		a.run(dns)
+	}
+
+	for _, component := range a.Components {
+		a.run(component)
+	}
+
+	for _, cluster := range a.QuorumClusters {
+		a.run(cluster)
+	}
+
+	for _, node := range a.KubeNodes {
+		a.run(node)
+	}
+
+	for _, pod := range a.Pods {
+		a.run(pod)
+	}
+
+	for _, deployment := range a.Deployments {
+		a.run(deployment)
+	}
+
+	for _, hypervisor := range a.Hypervisors {
+		a.run(hypervisor)
 	}
 
 	for _, monkey := range a.Monkeys {
 		a.sim.Process(monkey)
 	}
 
+	// Only the architectures that change need to store the history of the
+	// topology, with the initial one at time 0
+	if a.changing() {
+		a.history = newTopologyHistory()
+		a.history.record(a.graph(), 0)
+	}
+	for _, change := range a.Changes {
+		a.sim.Process(a.changeProcess(change))
+	}
+
 	a.sim.RunUntil(sim_duration)
 }
 
+// changing returns true if the topology could change during the simulation,
+// by the Changes, because the pods change of node when they are rescheduled
+// or because the guests change of hypervisor when they are migrated
+func (a *Architecture) changing() bool {
+	return len(a.Changes) > 0 || len(a.Pods) > 0 || len(a.Hypervisors) > 1
+}
+
 func (a *Architecture) NewServer(name string) *Server {
 	s := NewServer(name, a.mon)
 	a.AddServer(s)
@@ -107,13 +227,68 @@ func (a *Architecture) NewFrontend(name string, backend *Backend) *Frontend {
 	return f
 }
 
+func (a *Architecture) NewLoadBalancer(name string, frontends ...*Frontend) *LoadBalancer {
+	lb := NewLoadBalancer(name, a.mon, frontends...)
+	a.AddLoadBalancer(lb)
+	return lb
+}
+
+// NewLoadBalancerPool create a load balancer with a pool of members of any type
+func (a *Architecture) NewLoadBalancerPool(name string, members ...Service) *LoadBalancer {
+	lb := NewLoadBalancerPool(name, a.mon, members...)
+	a.AddLoadBalancer(lb)
+	return lb
+}
+
+// NewPoolFrontend create a frontend connected to the pool of the load balancer
+func (a *Architecture) NewPoolFrontend(name string, lb *LoadBalancer) *Frontend {
+	f := NewPoolFrontend(name, lb, a.mon)
+	a.AddFrontend(f)
+	return f
+}
+
 func (a *Architecture) NewDNS(name string) *DNS {
 	f := NewDNS(name, a.mon)
 	a.AddDNS(f)
 	return f
 }
 
-// TODO generalizar con generics para poder crear clusters de cualquier tipo
+func (a *Architecture) NewComponent(name string, kind *ComponentKind, dependencies ...Service) *Component {
+	c := NewComponent(name, kind, a.mon, dependencies...)
+	a.AddComponent(c)
+	return c
+}
+
+// NewCluster create a cluster of servers of any type, available while quorum
+// of them are available (the majority if 0)
+func (a *Architecture) NewCluster(name string, quorum int, members ...Service) *Cluster {
+	c := NewCluster(name, a.mon, quorum, members...)
+	a.AddCluster(c)
+	return c
+}
+
+func (a *Architecture) NewKubeNode(name string) *KubeNode {
+	n := NewKubeNode(name, a.mon)
+	a.AddKubeNode(n)
+	return n
+}
+
+// NewDeployment create a deployment with its pods scheduled in the nodes
+func (a *Architecture) NewDeployment(name string, replicas int, nodes ...*KubeNode) *Deployment {
+	d := NewDeployment(name, a.mon, replicas, nodes...)
+	a.AddDeployment(d)
+	return d
+}
+
+// NewHypervisor create a hypervisor with the guests running on it
+func (a *Architecture) NewHypervisor(name string, guests ...MonitoredServer) *Hypervisor {
+	h := NewHypervisor(name, a.mon, guests...)
+	a.AddHypervisor(h)
+	return h
+}
+
+// NewClusterDB link the databases between them in the graph. NewCluster
+// creates a cluster of any type, with its own node and alarms.
 func (a *Architecture) NewClusterDB(servers []*Database) {
 	c := make([]ArchitectureServer, len(servers))
 	for i, s := range servers {
@@ -138,15 +313,72 @@ func (a *Architecture) AddFrontend(frontend *Frontend) {
 	a.Frontends = append(a.Frontends, frontend)
 }
 
+func (a *Architecture) AddLoadBalancer(lb *LoadBalancer) {
+	a.LoadBalancers = append(a.LoadBalancers, lb)
+}
+
 func (a *Architecture) AddDNS(dns *DNS) {
+	dns.arch = a
 	a.DNSs = append(a.DNSs, dns)
 }
 
+func (a *Architecture) AddComponent(component *Component) {
+	a.Components = append(a.Components, component)
+}
+
+func (a *Architecture) AddCluster(cluster *Cluster) {
+	a.QuorumClusters = append(a.QuorumClusters, cluster)
+}
+
+func (a *Architecture) AddKubeNode(node *KubeNode) {
+	a.KubeNodes = append(a.KubeNodes, node)
+}
+
+// AddDeployment add the deployment and its pods
+func (a *Architecture) AddDeployment(deployment *Deployment) {
+	deployment.arch = a
+	a.Deployments = append(a.Deployments, deployment)
+	a.Pods = append(a.Pods, deployment.Pods...)
+}
+
+// AddHypervisor add the hypervisor, that could migrate its guests to the
+// other hypervisors of the architecture
+func (a *Architecture) AddHypervisor(hypervisor *Hypervisor) {
+	hypervisor.arch = a
+	a.Hypervisors = append(a.Hypervisors, hypervisor)
+}
+
+// AddMonkey add a monkey to the architecture. If the simulation is running it
+// is started immediately, so the faults added by a Change start when it happens.
 func (a *Architecture) AddMonkey(monkey func(simgo.Process)) {
 	a.Monkeys = append(a.Monkeys, monkey)
+	if a.sim != nil {
+		a.sim.Process(monkey)
+	}
 }
 
-// GetAllServers return all servers, dbs, backends, frontends and dns
+// AddFault compile the fault and add it as a monkey.
+// It panics if the fault references unknown servers or alarms.
+func (a *Architecture) AddFault(fault *Fault) {
+	monkey, err := fault.Monkey(a)
+	if err != nil {
+		panic(err)
+	}
+	a.AddMonkey(monkey)
+}
+
+// GetServer return the server with that name or nil if it does not exist
+func (a *Architecture) GetServer(name string) MonitoredServer {
+	for _, server := range a.GetAllServers() {
+		if server.GetName() == name {
+			return server
+		}
+	}
+	return nil
+}
+
+// GetAllServers return all servers, dbs, backends, frontends, load balancers,
+// dns, components, clusters, Kubernetes nodes, pods and deployments and hypervisors
 func (a *Architecture) GetAllServers() []MonitoredServer {
 	allServers := make([]MonitoredServer, 0)
 	for _, server := range a.Servers {
@@ -161,141 +393,29 @@ func (a *Architecture) GetAllServers() []MonitoredServer {
 	for _, frontend := range a.Frontends {
 		allServers = append(allServers, frontend)
 	}
+	for _, lb := range a.LoadBalancers {
+		allServers = append(allServers, lb)
+	}
 	for _, dns := range a.DNSs {
 		allServers = append(allServers, dns)
 	}
-	return allServers
-}
-
-func (a *Architecture) GraphML() *graphml.GraphML {
-	gm := graphml.NewGraphML("") // Si ponemos un description aquí, Cytoscape no es capaz de abrir el fichero
-	g, err := gm.AddGraph("ghostpipe-graph", graphml.EdgeDirectionUndirected, nil)
-	if err != nil {
-		panic(err)
+	for _, component := range a.Components {
+		allServers = append(allServers, component)
 	}
-
-	// Mapa para poder obtener el nodo a partir del server. Para crear los links
-	// entre servidores.
-	serverMap := make(map[string]*graphml.Node)
-
-	createServer := func(server ArchitectureServer) {
-		n, err := g.AddNode(map[string]interface{}{
-			"id":    server.GetName(),
-			"name":  server.GetName(),
-			"label": server.GetName(),
-			"type":  server.GetType(),
-		},
-			server.GetName(),
-		)
-		if err != nil {
-			panic(err)
-		}
-
-		serverMap[server.GetName()] = n
-
-		for _, alarmName := range server.GetAlarms() {
-			id := fmt.Sprintf("%d", a.mon.generateEventID(server.GetName(), alarmName))
-			alarm, err := g.AddNode(map[string]interface{}{
-				"id":    id,
-				"name":  fmt.Sprintf("%s-%s", server.GetName(), alarmName),
-				"label": alarmName,
-				"type":  AlarmNode,
-			},
-				fmt.Sprintf("%s-%s", server.GetName(), alarmName),
-			)
-			if err != nil {
-				panic(err)
-			}
-
-			_, err = g.AddEdge(n, alarm, map[string]interface{}{
-				"type":   TriggerEdge,
-				"weight": 1,
-			},
-				graphml.EdgeDirectionUndirected,
-				fmt.Sprintf("%s-%s", server.GetName(), alarmName),
-			)
-		}
-	}
-
-	// Add the Servers
-	for _, server := range a.Servers {
-		createServer(server)
-	}
-
-	for _, server := range a.DBs {
-		createServer(server)
-	}
-
-	for _, backend := range a.Backends {
-		createServer(backend)
-	}
-
-	for _, frontend := range a.Frontends {
-		createServer(frontend)
+	for _, cluster := range a.QuorumClusters {
+		allServers = append(allServers, cluster)
 	}
-
-	for _, dns := range a.DNSs {
-		createServer(dns)
+	for _, node := range a.KubeNodes {
+		allServers = append(allServers, node)
 	}
-
-	// Create links between servers
-	// Lo ejecutamos tras importar todos los servidores para asegurarnos de que
-	// ya se han añadido.
-
-	for _, backend := range a.Backends {
-		// Add edge between the backend and the database
-		_, err = g.AddEdge(serverMap[backend.Name], serverMap[backend.DBEngine.Name], map[string]interface{}{
-			"type":   ConnectEdge,
-			"weight": 1,
-		},
-			graphml.EdgeDirectionUndirected,
-			fmt.Sprintf("%s-%s", backend.Name, backend.DBEngine.Name),
-		)
+	for _, pod := range a.Pods {
+		allServers = append(allServers, pod)
 	}
-
-	for _, frontend := range a.Frontends {
-		// Add edge between the frontend and the backend
-		_, err = g.AddEdge(serverMap[frontend.Name], serverMap[frontend.Backend.Name], map[string]interface{}{
-			"type":   ConnectEdge,
-			"weight": 1,
-		},
-			graphml.EdgeDirectionUndirected,
-			fmt.Sprintf("%s-%s", frontend.Name, frontend.Backend.Name),
-		)
-	}
-
-	// Creamos links entre servidores que pertenecen a un cluster
-	for _, cluster := range a.Clusters {
-		for _, serverA := range cluster {
-			for _, serverB := range cluster {
-				// No crear links entre un servidor con sí mismo
-				if serverA.GetName() == serverB.GetName() {
-					continue
-				}
-
-				_, err = g.AddEdge(serverMap[serverA.GetName()], serverMap[serverB.GetName()], map[string]interface{}{
-					"type":   ConnectEdge,
-					"weight": 1,
-				},
-					graphml.EdgeDirectionUndirected,
-					fmt.Sprintf("%s-%s", serverA.GetName(), serverB.GetName()),
-				)
-			}
-		}
+	for _, deployment := range a.Deployments {
+		allServers = append(allServers, deployment)
 	}
-
-	// Creamos links entre los servidores que usan un DNS
-	for _, dns := range a.DNSs {
-		for _, server := range dns.Clients {
-			_, err = g.AddEdge(serverMap[dns.Name], serverMap[server.GetName()], map[string]interface{}{
-				"type":   DNSConnectEdge,
-				"weight": 1,
-			},
-				graphml.EdgeDirectionUndirected,
-				fmt.Sprintf("%s-%s", dns.Name, server.GetName()),
-			)
-		}
+	for _, hypervisor := range a.Hypervisors {
+		allServers = append(allServers, hypervisor)
 	}
-
-	return gm
+	return allServers
 }
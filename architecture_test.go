@@ -27,8 +27,9 @@ func TestGraphML(t *testing.T) {
       <key id="d1" for="node" attr.name="label" attr.type="string"></key>
       <key id="d2" for="node" attr.name="name" attr.type="string"></key>
       <key id="d3" for="node" attr.name="type" attr.type="string"></key>
-      <key id="d4" for="edge" attr.name="type" attr.type="string"></key>
-      <key id="d5" for="edge" attr.name="weight" attr.type="int"></key>
+      <key id="d4" for="node" attr.name="severity" attr.type="string"></key>
+      <key id="d5" for="edge" attr.name="type" attr.type="string"></key>
+      <key id="d6" for="edge" attr.name="weight" attr.type="int"></key>
       <graph id="g0" edgedefault="undirected">
           <desc>ghostpipe-graph</desc>
           <node id="n0">
@@ -43,6 +44,7 @@ func TestGraphML(t *testing.T) {
               <data key="d0">101</data>
               <data key="d1">CPU</data>
               <data key="d2">srv1-CPU</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
           <node id="n2">
@@ -50,6 +52,7 @@ func TestGraphML(t *testing.T) {
               <data key="d0">102</data>
               <data key="d1">Memory</data>
               <data key="d2">srv1-Memory</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
           <node id="n3">
@@ -57,6 +60,7 @@ func TestGraphML(t *testing.T) {
               <data key="d0">103</data>
               <data key="d1">Disk</data>
               <data key="d2">srv1-Disk</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
           <node id="n4">
@@ -64,262 +68,332 @@ func TestGraphML(t *testing.T) {
               <data key="d0">104</data>
               <data key="d1">Ping</data>
               <data key="d2">srv1-Ping</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
           <node id="n5">
+              <desc>srv1-DNS</desc>
+              <data key="d0">109</data>
+              <data key="d1">DNS</data>
+              <data key="d2">srv1-DNS</data>
+              <data key="d4">critical</data>
+              <data key="d3">alarm</data>
+          </node>
+          <node id="n6">
               <desc>db1</desc>
               <data key="d0">db1</data>
               <data key="d1">db1</data>
               <data key="d2">db1</data>
               <data key="d3">db</data>
           </node>
-          <node id="n6">
+          <node id="n7">
               <desc>db1-CPU</desc>
               <data key="d0">201</data>
               <data key="d1">CPU</data>
               <data key="d2">db1-CPU</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n7">
+          <node id="n8">
               <desc>db1-Memory</desc>
               <data key="d0">202</data>
               <data key="d1">Memory</data>
               <data key="d2">db1-Memory</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n8">
+          <node id="n9">
               <desc>db1-Disk</desc>
               <data key="d0">203</data>
               <data key="d1">Disk</data>
               <data key="d2">db1-Disk</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n9">
+          <node id="n10">
               <desc>db1-Ping</desc>
               <data key="d0">204</data>
               <data key="d1">Ping</data>
               <data key="d2">db1-Ping</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n10">
+          <node id="n11">
+              <desc>db1-DNS</desc>
+              <data key="d0">209</data>
+              <data key="d1">DNS</data>
+              <data key="d2">db1-DNS</data>
+              <data key="d4">critical</data>
+              <data key="d3">alarm</data>
+          </node>
+          <node id="n12">
               <desc>db1-DBEngine</desc>
               <data key="d0">205</data>
               <data key="d1">DBEngine</data>
               <data key="d2">db1-DBEngine</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n11">
+          <node id="n13">
               <desc>backend1</desc>
               <data key="d0">backend1</data>
               <data key="d1">backend1</data>
               <data key="d2">backend1</data>
               <data key="d3">backend</data>
           </node>
-          <node id="n12">
+          <node id="n14">
               <desc>backend1-CPU</desc>
               <data key="d0">301</data>
               <data key="d1">CPU</data>
               <data key="d2">backend1-CPU</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n13">
+          <node id="n15">
               <desc>backend1-Memory</desc>
               <data key="d0">302</data>
               <data key="d1">Memory</data>
               <data key="d2">backend1-Memory</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n14">
+          <node id="n16">
               <desc>backend1-Disk</desc>
               <data key="d0">303</data>
               <data key="d1">Disk</data>
               <data key="d2">backend1-Disk</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n15">
+          <node id="n17">
               <desc>backend1-Ping</desc>
               <data key="d0">304</data>
               <data key="d1">Ping</data>
               <data key="d2">backend1-Ping</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n16">
+          <node id="n18">
+              <desc>backend1-DNS</desc>
+              <data key="d0">309</data>
+              <data key="d1">DNS</data>
+              <data key="d2">backend1-DNS</data>
+              <data key="d4">critical</data>
+              <data key="d3">alarm</data>
+          </node>
+          <node id="n19">
               <desc>backend1-Proc</desc>
               <data key="d0">306</data>
               <data key="d1">Proc</data>
               <data key="d2">backend1-Proc</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n17">
+          <node id="n20">
               <desc>backend1-DBConnection</desc>
               <data key="d0">307</data>
               <data key="d1">DBConnection</data>
               <data key="d2">backend1-DBConnection</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n18">
+          <node id="n21">
               <desc>frontend1</desc>
               <data key="d0">frontend1</data>
               <data key="d1">frontend1</data>
               <data key="d2">frontend1</data>
               <data key="d3">frontend</data>
           </node>
-          <node id="n19">
+          <node id="n22">
               <desc>frontend1-CPU</desc>
               <data key="d0">401</data>
               <data key="d1">CPU</data>
               <data key="d2">frontend1-CPU</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n20">
+          <node id="n23">
               <desc>frontend1-Memory</desc>
               <data key="d0">402</data>
               <data key="d1">Memory</data>
               <data key="d2">frontend1-Memory</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n21">
+          <node id="n24">
               <desc>frontend1-Disk</desc>
               <data key="d0">403</data>
               <data key="d1">Disk</data>
               <data key="d2">frontend1-Disk</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n22">
+          <node id="n25">
               <desc>frontend1-Ping</desc>
               <data key="d0">404</data>
               <data key="d1">Ping</data>
               <data key="d2">frontend1-Ping</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n23">
+          <node id="n26">
+              <desc>frontend1-DNS</desc>
+              <data key="d0">409</data>
+              <data key="d1">DNS</data>
+              <data key="d2">frontend1-DNS</data>
+              <data key="d4">critical</data>
+              <data key="d3">alarm</data>
+          </node>
+          <node id="n27">
               <desc>frontend1-Proc</desc>
               <data key="d0">406</data>
               <data key="d1">Proc</data>
               <data key="d2">frontend1-Proc</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
-          <node id="n24">
+          <node id="n28">
               <desc>frontend1-BackendConnection</desc>
               <data key="d0">408</data>
               <data key="d1">BackendConnection</data>
               <data key="d2">frontend1-BackendConnection</data>
+              <data key="d4">critical</data>
               <data key="d3">alarm</data>
           </node>
           <edge id="e0" source="n0" target="n1" directed="false">
               <desc>srv1-CPU</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
           <edge id="e1" source="n0" target="n2" directed="false">
               <desc>srv1-Memory</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
           <edge id="e2" source="n0" target="n3" directed="false">
               <desc>srv1-Disk</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
           <edge id="e3" source="n0" target="n4" directed="false">
               <desc>srv1-Ping</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
+          </edge>
+          <edge id="e4" source="n0" target="n5" directed="false">
+              <desc>srv1-DNS</desc>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e4" source="n5" target="n6" directed="false">
+          <edge id="e5" source="n6" target="n7" directed="false">
               <desc>db1-CPU</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e5" source="n5" target="n7" directed="false">
+          <edge id="e6" source="n6" target="n8" directed="false">
               <desc>db1-Memory</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e6" source="n5" target="n8" directed="false">
+          <edge id="e7" source="n6" target="n9" directed="false">
               <desc>db1-Disk</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e7" source="n5" target="n9" directed="false">
+          <edge id="e8" source="n6" target="n10" directed="false">
               <desc>db1-Ping</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
+          </edge>
+          <edge id="e9" source="n6" target="n11" directed="false">
+              <desc>db1-DNS</desc>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e8" source="n5" target="n10" directed="false">
+          <edge id="e10" source="n6" target="n12" directed="false">
               <desc>db1-DBEngine</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e9" source="n11" target="n12" directed="false">
+          <edge id="e11" source="n13" target="n14" directed="false">
               <desc>backend1-CPU</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e10" source="n11" target="n13" directed="false">
+          <edge id="e12" source="n13" target="n15" directed="false">
               <desc>backend1-Memory</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e11" source="n11" target="n14" directed="false">
+          <edge id="e13" source="n13" target="n16" directed="false">
               <desc>backend1-Disk</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e12" source="n11" target="n15" directed="false">
+          <edge id="e14" source="n13" target="n17" directed="false">
               <desc>backend1-Ping</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e13" source="n11" target="n16" directed="false">
+          <edge id="e15" source="n13" target="n18" directed="false">
+              <desc>backend1-DNS</desc>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
+          </edge>
+          <edge id="e16" source="n13" target="n19" directed="false">
               <desc>backend1-Proc</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e14" source="n11" target="n17" directed="false">
+          <edge id="e17" source="n13" target="n20" directed="false">
               <desc>backend1-DBConnection</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e15" source="n18" target="n19" directed="false">
+          <edge id="e18" source="n21" target="n22" directed="false">
               <desc>frontend1-CPU</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e16" source="n18" target="n20" directed="false">
+          <edge id="e19" source="n21" target="n23" directed="false">
               <desc>frontend1-Memory</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e17" source="n18" target="n21" directed="false">
+          <edge id="e20" source="n21" target="n24" directed="false">
               <desc>frontend1-Disk</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e18" source="n18" target="n22" directed="false">
+          <edge id="e21" source="n21" target="n25" directed="false">
               <desc>frontend1-Ping</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
+          </edge>
+          <edge id="e22" source="n21" target="n26" directed="false">
+              <desc>frontend1-DNS</desc>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e19" source="n18" target="n23" directed="false">
+          <edge id="e23" source="n21" target="n27" directed="false">
               <desc>frontend1-Proc</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e20" source="n18" target="n24" directed="false">
+          <edge id="e24" source="n21" target="n28" directed="false">
               <desc>frontend1-BackendConnection</desc>
-              <data key="d4">trigger</data>
-              <data key="d5">1</data>
+              <data key="d5">trigger</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e21" source="n11" target="n5" directed="false">
+          <edge id="e25" source="n13" target="n6" directed="false">
               <desc>backend1-db1</desc>
-              <data key="d4">connect</data>
-              <data key="d5">1</data>
+              <data key="d5">connect</data>
+              <data key="d6">1</data>
           </edge>
-          <edge id="e22" source="n18" target="n11" directed="false">
+          <edge id="e26" source="n21" target="n13" directed="false">
               <desc>frontend1-backend1</desc>
-              <data key="d4">connect</data>
-              <data key="d5">1</data>
+              <data key="d5">connect</data>
+              <data key="d6">1</data>
           </edge>
       </graph>
   </graphml>`
@@ -334,3 +408,116 @@ func TestGraphML(t *testing.T) {
 
 	assert.Equal(t, expectedXML, buf.String())
 }
+
+// TestCytoscapeJSON checks that the Cytoscape JSON graph has the same nodes
+// and edges than the GraphML one
+func TestCytoscapeJSON(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	a := Architecture{mon: mon}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	dns := NewDNS("dns1", mon)
+	dns.AddClient(backend1)
+
+	a.AddDB(db1)
+	a.AddBackend(backend1)
+	a.AddDNS(dns)
+
+	cy := a.CytoscapeJSON()
+	assert.Equal(t, "ghostpipe-graph", cy.Data["name"])
+
+	// Same nodes and edges than GraphML
+	nodes := map[string]map[string]interface{}{}
+	for _, n := range cy.Elements.Nodes {
+		nodes[n.Data["id"].(string)] = n.Data
+	}
+	assert.Len(t, nodes, 3+len(db1.GetAlarms())+len(backend1.GetAlarms())+len(dns.GetAlarms()))
+	assert.Equal(t, "db", nodes["db1"]["type"])
+	assert.Equal(t, "backend", nodes["backend1"]["type"])
+	assert.Equal(t, "dns", nodes["dns1"]["type"])
+	assert.Equal(t, string(AlarmNode), nodes["201"]["type"])
+	assert.Equal(t, "db1-CPU", nodes["201"]["name"])
+	assert.Equal(t, "CPU", nodes["201"]["label"])
+
+	edges := map[string]EdgeType{}
+	for _, e := range cy.Elements.Edges {
+		// Edges reference existing nodes by id
+		assert.Contains(t, nodes, e.Data["source"])
+		assert.Contains(t, nodes, e.Data["target"])
+		edges[e.Data["name"].(string)] = e.Data["type"].(EdgeType)
+	}
+	assert.Equal(t, TriggerEdge, edges["db1-CPU"])
+	assert.Equal(t, ConnectEdge, edges["backend1-db1"])
+	assert.Equal(t, DNSConnectEdge, edges["backend1-dns1"])
+
+	var buf bytes.Buffer
+	assert.NoError(t, cy.Encode(&buf, false))
+	assert.Contains(t, buf.String(), `"elements":{"nodes":[{"data":{"id":"db1","label":"db1","name":"db1","type":"db"}}`)
+}
+
+// TestDirectedWeightedGraph checks that the edges follow the dependencies and
+// have the weight of their type
+func TestDirectedWeightedGraph(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	a := Architecture{mon: mon}
+	a.GraphOptions = GraphOptions{
+		Directed: true,
+		Weights:  map[EdgeType]float64{DNSConnectEdge: 0.2},
+	}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	frontend1 := &Frontend{Server: Server{Name: "frontend1", mon: mon}, Backend: backend1}
+	dns := NewDNS("dns1", mon)
+	dns.AddClient(backend1)
+
+	a.AddDB(db1)
+	a.AddBackend(backend1)
+	a.AddFrontend(frontend1)
+	a.AddDNS(dns)
+	a.Clusters = append(a.Clusters, []ArchitectureServer{db1, backend1})
+
+	type edge struct {
+		source, target string
+		weight         float64
+	}
+	edges := []edge{}
+	for _, e := range a.CytoscapeJSON().Elements.Edges {
+		if e.Data["type"] != TriggerEdge {
+			edges = append(edges, edge{e.Data["source"].(string), e.Data["target"].(string), e.Data["weight"].(float64)})
+		}
+	}
+	assert.ElementsMatch(t, []edge{
+		{"backend1", "db1", 1},
+		{"frontend1", "backend1", 1},
+		// Both directions between the members of a cluster
+		{"db1", "backend1", 1},
+		{"backend1", "dns1", 0.2},
+	}, edges)
+
+	var buf bytes.Buffer
+	assert.NoError(t, a.GraphML().Encode(&buf, false))
+	assert.Contains(t, buf.String(), `edgedefault="directed"`)
+	assert.Contains(t, buf.String(), `attr.name="weight" attr.type="double"`)
+	assert.Contains(t, buf.String(), `<data key="d6">0.2</data>`)
+}
+
+// TestSeedReproducible checks that two simulations with the same seed generate
+// the same events
+func TestSeedReproducible(t *testing.T) {
+	simulate := func(seed int64) []Event {
+		mon := &fakeMonSys{}
+		a := Architecture{mon: mon, Seed: seed}
+		MiniBackendFrontendNoise(&a)
+		a.Start(60 * 6)
+		return mon.Events
+	}
+
+	events := simulate(42)
+	assert.NotEmpty(t, events)
+	assert.Equal(t, events, simulate(42))
+	assert.NotEqual(t, events, simulate(43))
+}
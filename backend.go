@@ -8,9 +8,39 @@ type Backend struct {
 	// DBConnectionAlarm is True if the database is not working
 	DBConnectionAlarm AlarmStatus
 	DBEngine          *Database
+	// Replicas of the database, used in order while DBEngine is not available.
+	// The backend raises Failover instead of DBConnection while it uses one of them.
+	Replicas []*Database
+	// Dependencies are other services used by the backend, besides the database
+	Dependencies []*BackendDependency
+	// Transitive makes the backend unavailable while the connection to the
+	// database is lost, so the failure of the database reaches its clients
+	Transitive bool
 
-	// dnsAvailable used to store the state of the DNS server the last time CheckAlarms was called.
-	dnsAvailable bool
+	// status of the alarms of the replicas and the dependencies
+	status map[string]AlarmStatus
+}
+
+// BackendDependency is a service used by a backend. While it is not
+// available the backend raises the Connection:<name> alarm, or the
+// Failover:<name> alarm if one of its replicas is available.
+type BackendDependency struct {
+	Service Service
+	// Replicas are used, in order, while Service is not available
+	Replicas []Service
+	// Optional dependencies raise their alarm as a warning, and do not make a
+	// Transitive backend unavailable
+	Optional bool
+}
+
+// ConnectionAlarm return the name of the alarm raised while the dependency is not available
+func ConnectionAlarm(dependency string) string {
+	return "Connection:" + dependency
+}
+
+// FailoverAlarm return the name of the alarm raised while a replica of the dependency is used
+func FailoverAlarm(dependency string) string {
+	return "Failover:" + dependency
 }
 
 // NewBackend create a new backend server, start it and return the pointer to it
@@ -24,59 +54,176 @@ func NewBackend(name string, connectedDB *Database, mon MonitorSystem) *Backend
 	}
 }
 
+// AddReplica add a replica of the database. Failover is a warning unless other severity is set.
+func (b *Backend) AddReplica(replica *Database) {
+	b.Replicas = append(b.Replicas, replica)
+	b.defaultSeverity("Failover", SeverityWarning)
+}
+
+// AddDependency add a service used by the backend, with its replicas.
+// Failover, and the alarm of the optional dependencies, are warnings unless
+// other severity is set.
+func (b *Backend) AddDependency(service Service, optional bool, replicas ...Service) *BackendDependency {
+	d := &BackendDependency{Service: service, Replicas: replicas, Optional: optional}
+	b.Dependencies = append(b.Dependencies, d)
+	if optional {
+		b.defaultSeverity(ConnectionAlarm(service.GetName()), SeverityWarning)
+	}
+	if len(replicas) > 0 {
+		b.defaultSeverity(FailoverAlarm(service.GetName()), SeverityWarning)
+	}
+	return d
+}
+
+// defaultSeverity set the base severity of the alarm if it has none
+func (b *Backend) defaultSeverity(alarm string, severity Severity) {
+	if b.Severities[alarm] == NoSeverity {
+		b.SetSeverity(alarm, severity)
+	}
+}
+
 func (b *Backend) GetName() string {
 	return b.Name
 }
 
 func (s *Backend) GetAlarms() []string {
 	serverAlarms := s.Server.GetAlarms()
-	return append(serverAlarms, []string{"Proc", "DBConnection"}...)
+	return append(append(serverAlarms, []string{"Proc", "DBConnection"}...), s.dependencyAlarms()...)
+}
+
+// dependencyAlarms return the alarms of the replicas and the dependencies
+func (b *Backend) dependencyAlarms() []string {
+	alarms := []string{}
+	if len(b.Replicas) > 0 {
+		alarms = append(alarms, "Failover")
+	}
+	for _, d := range b.Dependencies {
+		alarms = append(alarms, ConnectionAlarm(d.Service.GetName()))
+		if len(d.Replicas) > 0 {
+			alarms = append(alarms, FailoverAlarm(d.Service.GetName()))
+		}
+	}
+	return alarms
 }
 
 func (s *Backend) GetType() string {
 	return string(BackendNode)
 }
 
+// connect return the service used by the backend: the primary if it is
+// available, or the first replica available, or nil if all are down. All of
+// them are checked to notice their failures.
+func (b *Backend) connect(primary Service, replicas []Service, t float64) Service {
+	var used Service
+	for _, s := range append([]Service{primary}, replicas...) {
+		if !b.noticeDown(s, t) && used == nil {
+			used = s
+		}
+	}
+	return used
+}
+
+// derive set the status of an alarm derived from a dependency, using the
+// cause of the dependency when it is triggered
+func (b *Backend) derive(alarm string, triggered bool, dependency Service) {
+	if !triggered {
+		b.status[alarm] = AlarmEnabled
+	} else if b.status[alarm] == AlarmEnabled {
+		b.status[alarm] = AlarmTriggered
+		b.SetIncident(alarm, dependency.Cause())
+	}
+}
+
 // CheckAlarms print a message if the server has alarms.
 // It check alarms specific to the backend, plus generic alarms for the server
 // and also generate an alarm if the database is not available.
 func (b *Backend) CheckAlarms(t float64) {
-	if b.ProcAlarm == AlarmTriggered {
-		b.ProcAlarm = AlarmACK
-		b.mon.handleAlarm(b.Name, "Proc", t)
+	if b.status == nil {
+		b.status = make(map[string]AlarmStatus)
 	}
 
+	b.checkAlarm("Proc", &b.ProcAlarm, t)
+
 	// Set the local db connection alarm based on the state of the database.
-	// Generate a new alarm if we are moving from enabled to triggered.
-	if b.DBEngine.Available() {
-		b.DBConnectionAlarm = AlarmEnabled
+	// If DNS server is not available, backend could not communicate with the
+	// database, so we also trigger the DBConnection alarm.
+	// The alarm is resolved when both are available again.
+	var dbDown bool
+	if len(b.Replicas) == 0 {
+		dbDown = b.noticeDown(b.DBEngine, t)
 	} else {
-		if b.DBConnectionAlarm == AlarmEnabled {
-			b.DBConnectionAlarm = AlarmACK
-			b.mon.handleAlarm(b.Name, "DBConnection", t)
+		replicas := make([]Service, len(b.Replicas))
+		for i, r := range b.Replicas {
+			replicas[i] = r
 		}
+		used := b.connect(b.DBEngine, replicas, t)
+		dbDown = used == nil
+		b.derive("Failover", used != nil && used != Service(b.DBEngine), b.DBEngine)
 	}
+	if !dbDown && b.Server.DNSAlarm == AlarmEnabled {
+		b.DBConnectionAlarm = AlarmEnabled
+	} else if b.DBConnectionAlarm == AlarmEnabled {
+		b.DBConnectionAlarm = AlarmTriggered
+		if dbDown {
+			b.SetIncident("DBConnection", b.DBEngine.Cause())
+		} else {
+			b.SetIncident("DBConnection", b.incident("DNS"))
+		}
+	}
+	b.checkAlarm("DBConnection", &b.DBConnectionAlarm, t)
 
-	// If DNS server is not available, backend could not communicate with the database,
-	// so we also trigger the DBConnection alarm.
-	if b.Server.DNSAlarm == AlarmTriggered && b.DBConnectionAlarm == AlarmEnabled {
-		b.DBConnectionAlarm = AlarmACK
-		b.dnsAvailable = false
-		b.mon.handleAlarm(b.Name, "DBConnection", t)
+	for _, d := range b.Dependencies {
+		used := b.connect(d.Service, d.Replicas, t)
+		b.derive(ConnectionAlarm(d.Service.GetName()), used == nil, d.Service)
+		if len(d.Replicas) > 0 {
+			b.derive(FailoverAlarm(d.Service.GetName()), used != nil && used != d.Service, d.Service)
+		}
 	}
-	// If DNS was unavailable and is now available, we can clear the DBConnection alarm.
-	if !b.dnsAvailable && b.Server.DNSAlarm == AlarmEnabled && b.DBConnectionAlarm == AlarmACK {
-		b.dnsAvailable = true
-		b.DBConnectionAlarm = AlarmEnabled
+	for _, alarm := range b.dependencyAlarms() {
+		status := b.status[alarm]
+		b.checkAlarm(alarm, &status, t)
+		b.status[alarm] = status
 	}
 
 	b.Server.CheckAlarms(t)
 }
 
+// requiredDown return the alarm of the first required dependency that is not
+// available, or "" if all of them are available
+func (b *Backend) requiredDown() string {
+	for _, d := range b.Dependencies {
+		alarm := ConnectionAlarm(d.Service.GetName())
+		if !d.Optional && b.failed(alarm, b.status[alarm]) {
+			return alarm
+		}
+	}
+	return ""
+}
+
 // Available returns true if the backend server is considered available, that is,
-// if the backend process is running and the database is available.
+// if the backend process is running and, if it is Transitive, the database
+// and the required dependencies are available.
 func (b *Backend) Available() bool {
-	return b.Server.Available() && b.ProcAlarm == AlarmEnabled
+	if b.Transitive && (b.failed("DBConnection", b.DBConnectionAlarm) || b.requiredDown() != "") {
+		return false
+	}
+	return b.Server.Available() && !b.failed("Proc", b.ProcAlarm)
+}
+
+// Cause returns the incident that made the backend server unavailable
+func (b *Backend) Cause() string {
+	if !b.Server.Available() {
+		return b.Server.Cause()
+	}
+	if !b.failed("Proc", b.ProcAlarm) && b.Transitive {
+		if b.failed("DBConnection", b.DBConnectionAlarm) {
+			return b.incident("DBConnection")
+		}
+		if alarm := b.requiredDown(); alarm != "" {
+			return b.incident(alarm)
+		}
+	}
+	return b.incident("Proc")
 }
 
 func (b *Backend) SetAlarm(alarm string, status AlarmStatus) {
@@ -86,6 +233,31 @@ func (b *Backend) SetAlarm(alarm string, status AlarmStatus) {
 	case "DBConnection":
 		b.DBConnectionAlarm = status
 	default:
+		for _, a := range b.dependencyAlarms() {
+			if a == alarm {
+				if b.status == nil {
+					b.status = make(map[string]AlarmStatus)
+				}
+				b.status[alarm] = status
+				return
+			}
+		}
 		b.Server.SetAlarm(alarm, status)
 	}
 }
+
+// alarmStatus return the status of any alarm of the backend
+func (b *Backend) alarmStatus(alarm string) AlarmStatus {
+	switch alarm {
+	case "Proc":
+		return b.ProcAlarm
+	case "DBConnection":
+		return b.DBConnectionAlarm
+	}
+	for _, a := range b.dependencyAlarms() {
+		if a == alarm {
+			return b.status[alarm]
+		}
+	}
+	return b.Server.alarmStatus(alarm)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -110,3 +111,190 @@ func TestDBRetriggerAffectsBackend(t *testing.T) {
 
 	assert.Equal(t, mon.Alarms, []string{"2,db1,Ping", "2,backend1,DBConnection"})
 }
+
+// TestBackendAlarmCarriesDBIncident checks that the DBConnection alarm is
+// labeled with the incident that made the database unavailable
+func TestBackendAlarmCarriesDBIncident(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	srv1 := &Server{Name: "srv1", mon: mon}
+
+	// Injected fault in the database and noise in other server
+	db1.SetAlarm("DBEngine", AlarmTriggered)
+	db1.SetIncident("DBEngine", "db1-down-0")
+	srv1.SetAlarm("CPU", AlarmTriggered)
+
+	db1.CheckAlarms(0)
+	backend1.CheckAlarms(0)
+	srv1.CheckAlarms(0)
+
+	assert.Equal(t, []Event{
+		{Time: 0, Server: "db1", Alarm: "DBEngine", Incident: "db1-down-0", State: ProblemState, Severity: SeverityCritical},
+		{Time: 0, Server: "backend1", Alarm: "DBConnection", Incident: "db1-down-0", State: ProblemState, Severity: SeverityCritical},
+		{Time: 0, Server: "srv1", Alarm: "CPU", Incident: NoiseIncident, State: ProblemState, Severity: SeverityCritical},
+	}, mon.Events)
+}
+
+// TestDBRecoveryResolvesBackendAlarm checks the full lifecycle of the alarms:
+// problem when the db goes down and resolved when it comes back
+func TestDBRecoveryResolvesBackendAlarm(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+
+	db1.SetAlarm("Ping", AlarmTriggered)
+	db1.SetIncident("Ping", "db1-down-0")
+	db1.CheckAlarms(0)
+	backend1.CheckAlarms(0)
+
+	// Nothing new while the db is still down
+	db1.CheckAlarms(1)
+	backend1.CheckAlarms(1)
+
+	// The fault ends, clearing the alarm and the incident
+	db1.SetAlarm("Ping", AlarmEnabled)
+	db1.SetIncident("Ping", "")
+	db1.CheckAlarms(2)
+	backend1.CheckAlarms(2)
+
+	assert.Equal(t, []Event{
+		{Time: 0, Server: "db1", Alarm: "Ping", Incident: "db1-down-0", State: ProblemState, Severity: SeverityCritical},
+		{Time: 0, Server: "backend1", Alarm: "DBConnection", Incident: "db1-down-0", State: ProblemState, Severity: SeverityCritical},
+		{Time: 2, Server: "db1", Alarm: "Ping", Incident: "db1-down-0", State: ResolvedState, Severity: SeverityCritical},
+		{Time: 2, Server: "backend1", Alarm: "DBConnection", Incident: "db1-down-0", State: ResolvedState, Severity: SeverityCritical},
+	}, mon.Events)
+}
+
+// TestBackendAlarmAlias tests that the backend reports the DBConnection alarm
+// with its alias, in the events and in the graph
+func TestBackendAlarmAlias(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	backend1.SetAlias("DBConnection", "SQLPoolExhausted")
+
+	db1.PingAlarm = AlarmTriggered
+	db1.CheckAlarms(1)
+	backend1.CheckAlarms(1)
+	assert.Equal(t, []string{"1,db1,Ping", "1,backend1,SQLPoolExhausted"}, mon.Alarms)
+
+	a := Architecture{mon: mon}
+	a.AddDB(db1)
+	a.AddBackend(backend1)
+
+	labels := []string{}
+	for _, n := range a.CytoscapeJSON().Elements.Nodes {
+		if n.Data["name"] == "backend1-SQLPoolExhausted" {
+			assert.Equal(t, "310", n.Data["id"])
+			labels = append(labels, n.Data["label"].(string))
+		}
+	}
+	assert.Equal(t, []string{"SQLPoolExhausted"}, labels)
+}
+
+// TestBackendFailover checks that the backend switches to the replica when
+// the primary database is down, raising Failover instead of DBConnection
+func TestBackendFailover(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	db2 := &Database{Server: Server{Name: "db2", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1, Transitive: true}
+	backend1.AddReplica(db2)
+
+	time := 0.0
+	checkAll := func() {
+		db1.CheckAlarms(time)
+		db2.CheckAlarms(time)
+		backend1.CheckAlarms(time)
+		time++
+	}
+
+	// The primary is down, the backend uses the replica
+	db1.PingAlarm = AlarmTriggered
+	db1.SetIncident("Ping", "db1-down-0")
+	checkAll()
+	assert.Equal(t, []string{"0,db1,Ping", "0,backend1,Failover"}, mon.Alarms)
+	assert.Equal(t, SeverityWarning, mon.Events[1].Severity)
+	assert.Equal(t, "db1-down-0", mon.Events[1].Incident)
+	assert.True(t, backend1.Available())
+
+	// The replica is also down, the connection is lost
+	db2.DBEngineAlarm = AlarmTriggered
+	checkAll()
+	assert.Equal(t, []string{"0,db1,Ping", "0,backend1,Failover", "1,db2,DBEngine", "1,backend1,DBConnection"}, mon.Alarms)
+	events := eventLines(mon)
+	assert.Equal(t, "1,backend1,Failover,resolved,warning", events[len(events)-1])
+	assert.False(t, backend1.Available())
+	assert.Equal(t, "db1-down-0", backend1.Cause())
+}
+
+// TestBackendDependencies checks that only the required dependencies make
+// the backend unavailable
+func TestBackendDependencies(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	cache1 := &Server{Name: "cache1", mon: mon}
+	auth1 := &Server{Name: "auth1", mon: mon}
+	auth2 := &Server{Name: "auth2", mon: mon}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1, Transitive: true}
+	backend1.AddDependency(cache1, true)
+	backend1.AddDependency(auth1, false, auth2)
+
+	assert.Equal(t, []string{
+		"CPU", "Memory", "Disk", "Ping", "DNS", "Proc", "DBConnection",
+		"Connection:cache1", "Connection:auth1", "Failover:auth1",
+	}, backend1.GetAlarms())
+
+	// The optional dependency is a warning
+	cache1.PingAlarm = AlarmTriggered
+	backend1.CheckAlarms(0)
+	assert.Equal(t, []string{"0,backend1,Connection:cache1"}, mon.Alarms)
+	assert.Equal(t, SeverityWarning, mon.Events[0].Severity)
+	assert.True(t, backend1.Available())
+
+	// The required one fails over to its replica
+	auth1.PingAlarm = AlarmTriggered
+	backend1.CheckAlarms(1)
+	assert.True(t, backend1.Available())
+
+	auth2.PingAlarm = AlarmTriggered
+	auth2.SetIncident("Ping", "auth-down-0")
+	backend1.CheckAlarms(2)
+	assert.Equal(t, []string{
+		"0,backend1,Connection:cache1",
+		"1,backend1,Failover:auth1",
+		"2,backend1,Connection:auth1",
+	}, mon.Alarms)
+	assert.False(t, backend1.Available())
+	assert.Equal(t, NoiseIncident, backend1.Cause())
+}
+
+func TestTopologyBackendDependencies(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `databases:
+  - name: db1
+  - name: db2
+servers:
+  - name: cache1
+backends:
+  - name: backend1
+    database: db1
+    replicas: [db2]
+    dependencies:
+      - service: cache1
+        optional: true
+      - service: auth1
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:7: backend "backend1" references unknown dependency "auth1"`)
+
+	backend1 := a.Backends[0]
+	assert.Equal(t, []*Database{a.DBs[1]}, backend1.Replicas)
+	if assert.Len(t, backend1.Dependencies, 1) {
+		assert.Equal(t, a.Servers[0], backend1.Dependencies[0].Service)
+		assert.True(t, backend1.Dependencies[0].Optional)
+	}
+}
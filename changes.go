@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fschuetz04/simgo"
+)
+
+// Change is a modification of the architecture at some time of the
+// simulation, like installing new servers or removing old ones.
+type Change struct {
+	// Time of the simulation when the change is applied
+	Time float64
+	// Apply modify the architecture: add or remove servers, link or unlink
+	// them, add faults...
+	Apply func(a *Architecture)
+}
+
+// At schedule a change of the architecture at time t of the simulation.
+// The servers added by the change start to be monitored at that time and the
+// removed ones stop. The faults added by the change start at that time.
+func (a *Architecture) At(t float64, apply func(a *Architecture)) {
+	a.Changes = append(a.Changes, &Change{Time: t, Apply: apply})
+}
+
+// changeProcess return the simulation process that apply the change
+func (a *Architecture) changeProcess(change *Change) func(simgo.Process) {
+	return func(proc simgo.Process) {
+		if change.Time > proc.Now() {
+			proc.Wait(proc.Timeout(change.Time - proc.Now()))
+		}
+
+		change.Apply(a)
+
+		// Start monitoring the new servers
+		for _, server := range a.GetAllServers() {
+			if !a.running[server] {
+				a.run(server)
+			}
+		}
+
+		a.history.record(a.graph(), proc.Now())
+	}
+}
+
+// RemoveServer remove the server from the architecture and from the DNS,
+// load balancers, clusters and hypervisors it belongs to. It stops being
+// monitored, and it is not exported in the graph anymore. Servers depending
+// on it should be removed or connected to other server by the same change.
+// It panics if the server does not exist.
+func (a *Architecture) RemoveServer(name string) {
+	server := a.GetServer(name)
+	if server == nil {
+		panic(fmt.Sprintf("Unknown server: %s", name))
+	}
+
+	switch s := server.(type) {
+	case *Server:
+		s.removed = true
+		for i, x := range a.Servers {
+			if x == s {
+				a.Servers = append(a.Servers[:i], a.Servers[i+1:]...)
+				break
+			}
+		}
+	case *Database:
+		s.removed = true
+		for i, x := range a.DBs {
+			if x == s {
+				a.DBs = append(a.DBs[:i], a.DBs[i+1:]...)
+				break
+			}
+		}
+	case *Backend:
+		s.removed = true
+		for i, x := range a.Backends {
+			if x == s {
+				a.Backends = append(a.Backends[:i], a.Backends[i+1:]...)
+				break
+			}
+		}
+	case *Frontend:
+		s.removed = true
+		for i, x := range a.Frontends {
+			if x == s {
+				a.Frontends = append(a.Frontends[:i], a.Frontends[i+1:]...)
+				break
+			}
+		}
+		for _, lb := range a.LoadBalancers {
+			lb.RemoveFrontend(s)
+		}
+	case *LoadBalancer:
+		s.removed = true
+		for i, x := range a.LoadBalancers {
+			if x == s {
+				a.LoadBalancers = append(a.LoadBalancers[:i], a.LoadBalancers[i+1:]...)
+				break
+			}
+		}
+	case *DNS:
+		s.removed = true
+		for i, x := range a.DNSs {
+			if x == s {
+				a.DNSs = append(a.DNSs[:i], a.DNSs[i+1:]...)
+				break
+			}
+		}
+		// Its clients don't use it anymore
+		for client, trigger := range s.down {
+			a.clearAlarms(trigger, []MonitoredServer{client}, []string{"DNS"})
+		}
+	case *Component:
+		s.removed = true
+		for i, x := range a.Components {
+			if x == s {
+				a.Components = append(a.Components[:i], a.Components[i+1:]...)
+				break
+			}
+		}
+	case *Cluster:
+		s.removed = true
+		for i, x := range a.QuorumClusters {
+			if x == s {
+				a.QuorumClusters = append(a.QuorumClusters[:i], a.QuorumClusters[i+1:]...)
+				break
+			}
+		}
+	case *KubeNode:
+		// Its pods are rescheduled in other nodes after the delay
+		s.removed = true
+		for i, x := range a.KubeNodes {
+			if x == s {
+				a.KubeNodes = append(a.KubeNodes[:i], a.KubeNodes[i+1:]...)
+				break
+			}
+		}
+		for _, d := range a.Deployments {
+			d.removeNode(s)
+		}
+	case *Pod:
+		s.removed = true
+		for i, x := range a.Pods {
+			if x == s {
+				a.Pods = append(a.Pods[:i], a.Pods[i+1:]...)
+				break
+			}
+		}
+		if s.Deployment != nil {
+			s.Deployment.removePod(s)
+		}
+	case *Deployment:
+		// The pods of the deployment are removed with it
+		s.removed = true
+		for i, x := range a.Deployments {
+			if x == s {
+				a.Deployments = append(a.Deployments[:i], a.Deployments[i+1:]...)
+				break
+			}
+		}
+		for _, pod := range append([]*Pod{}, s.Pods...) {
+			a.RemoveServer(pod.Name)
+		}
+	case *Hypervisor:
+		// Its guests keep running, but not on any hypervisor, so they are
+		// up again if it was down
+		s.removed = true
+		for i, x := range a.Hypervisors {
+			if x == s {
+				a.Hypervisors = append(a.Hypervisors[:i], a.Hypervisors[i+1:]...)
+				break
+			}
+		}
+		if s.down {
+			s.up()
+		}
+	}
+
+	for _, hypervisor := range a.Hypervisors {
+		hypervisor.RemoveGuest(server)
+	}
+
+	for _, dns := range a.DNSs {
+		dns.RemoveClient(server)
+	}
+
+	if service, ok := server.(Service); ok {
+		for _, lb := range a.LoadBalancers {
+			lb.RemoveMember(service)
+		}
+		for _, cluster := range a.QuorumClusters {
+			cluster.RemoveMember(service)
+		}
+	}
+
+	for i, cluster := range a.Clusters {
+		members := cluster[:0]
+		for _, member := range cluster {
+			if member.GetName() != name {
+				members = append(members, member)
+			}
+		}
+		a.Clusters[i] = members
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchitectureChanges(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := &Architecture{mon: mon}
+
+	srv1 := a.NewServer("srv1")
+	a.AddFault(&Fault{Name: "srv1-cpu", Target: srv1.Name, Alarm: "CPU", Start: Constant(25)})
+
+	// db1 is installed at 10 and fails at 15
+	a.At(10, func(a *Architecture) {
+		db1 := a.NewDatabase("db1")
+		a.AddFault(&Fault{Name: "db1-down", Target: db1.Name, Alarm: "Ping", Start: Constant(5)})
+	})
+	// srv1 is removed at 20, so its fault at 25 does not generate events
+	a.At(20, func(a *Architecture) {
+		a.RemoveServer("srv1")
+	})
+	a.Start(30)
+
+	assert.Len(t, mon.Events, 1)
+	assert.Equal(t, "db1", mon.Events[0].Server)
+	assert.Equal(t, "Ping", mon.Events[0].Alarm)
+	assert.InDelta(t, 15, mon.Events[0].Time, 1.5)
+	assert.Empty(t, a.Servers)
+	assert.True(t, srv1.Removed())
+
+	nodes := func() []string {
+		names := []string{}
+		for _, n := range a.CytoscapeJSON().Elements.Nodes {
+			if n.Data["type"] != string(AlarmNode) {
+				names = append(names, n.Data["name"].(string))
+			}
+		}
+		return names
+	}
+
+	// By default, the topology at the end of the simulation
+	assert.Equal(t, []string{"db1"}, nodes())
+
+	at := 5.0
+	a.GraphOptions.At = &at
+	assert.Equal(t, []string{"srv1"}, nodes())
+
+	at = 15
+	assert.Equal(t, []string{"srv1", "db1"}, nodes())
+
+	// With intervals, every node with its start and end in seconds
+	a.GraphOptions = GraphOptions{Intervals: true}
+	for _, n := range a.CytoscapeJSON().Elements.Nodes {
+		switch n.Data["name"] {
+		case "srv1", "srv1-CPU":
+			assert.Equal(t, 0.0, n.Data["start"])
+			assert.Equal(t, 20.0*60, n.Data["end"])
+		case "db1", "db1-Ping":
+			assert.Equal(t, 10.0*60, n.Data["start"])
+			assert.Equal(t, -1.0, n.Data["end"])
+		}
+	}
+}
+
+func TestRemoveServerFromDNS(t *testing.T) {
+	a := &Architecture{mon: &fakeMonSys{}}
+	srv1 := a.NewServer("srv1")
+	db1 := a.NewDatabase("db1")
+	dns := a.NewDNS("dns1")
+	dns.AddClient(srv1)
+	dns.AddClient(db1)
+
+	a.RemoveServer("srv1")
+	assert.Equal(t, []MonitoredServer{db1}, dns.Clients)
+	assert.Nil(t, a.GetServer("srv1"))
+	assert.Panics(t, func() { a.RemoveServer("srv1") })
+}
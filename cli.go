@@ -0,0 +1,682 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDataset is the dataset used if none is selected
+const DefaultDataset = "RelacionesInesperadas"
+
+// command is a subcommand of the command line
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"list", "List the available datasets", listCommand},
+		{"run", "Simulate a dataset writing the events, incidents and graph", runCommand},
+		{"graph", "Write the graph of a dataset without simulating it", graphCommand},
+		{"score", "Evaluate the clusters of a correlator against the incidents", scoreCommand},
+		{"correlate", "Group the events with one of the baseline correlators", correlateCommand},
+		{"report", "Score the baseline correlators on the output of a simulation", reportCommand},
+	}
+}
+
+// runCLI execute the subcommand in args and return the exit code.
+// Without subcommand, or if the first argument is a flag, "run" is used.
+func runCLI(args []string) int {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage(os.Stdout)
+		return 0
+	}
+
+	for _, c := range commands() {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				if err != flag.ErrHelp {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: ghostpipe <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(w, "\nUse \"ghostpipe <command> -h\" to see the flags of each command.")
+}
+
+func listCommand(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, d := range Datasets() {
+		fmt.Printf("%-26s %s\n", d.Name, d.Description)
+	}
+	return nil
+}
+
+// seedFlag is the value of --seed. It remembers if it was given, so any
+// number, even 0, is a seed that could be repeated.
+type seedFlag struct {
+	value int64
+	set   bool
+}
+
+func (s *seedFlag) String() string {
+	if s == nil || !s.set {
+		return ""
+	}
+	return strconv.FormatInt(s.value, 10)
+}
+
+func (s *seedFlag) Set(value string) error {
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	s.value, s.set = seed, true
+	return nil
+}
+
+// architectureFlags are the flags used to select and build the architecture
+type architectureFlags struct {
+	dataset  *string
+	topology *string
+	scenario *string
+	seed     *seedFlag
+}
+
+func addArchitectureFlags(fs *flag.FlagSet) *architectureFlags {
+	f := &architectureFlags{
+		dataset:  fs.String("dataset", DefaultDataset, "Name of the dataset to use (see \"ghostpipe list\")"),
+		topology: fs.String("topology", "", "Topology file (YAML or JSON) to use instead of a dataset"),
+		scenario: fs.String("scenario", "", "Scenario file (YAML or JSON) with faults to inject in the architecture"),
+		seed:     &seedFlag{},
+	}
+	fs.Var(f.seed, "seed", "Seed for the random generator. By default a random seed is used")
+	return f
+}
+
+// build create the monitoring system and the architecture selected by the flags
+func (f *architectureFlags) build() (*Architecture, *PrinterMonitorSystem, error) {
+	// Without an explicit seed use a random one, it is printed and saved in
+	// the metadata to be able to reproduce the simulation
+	if !f.seed.set {
+		f.seed.value, f.seed.set = time.Now().UnixNano(), true
+	}
+	fmt.Printf("Using seed %d\n", f.seed.value)
+
+	// Create the monitoring system
+	mon := &PrinterMonitorSystem{}
+
+	// Create the architecture. The monitoring system has its own random
+	// generator, so the IDs generated when exporting the graph don't change
+	// the random numbers of the simulation.
+	a := &Architecture{mon: mon, Seed: f.seed.value}
+	mon.Rand = rand.New(rand.NewSource(f.seed.value))
+
+	if *f.topology != "" {
+		// Load the topology from a file
+		*f.dataset = ""
+		if err := LoadTopology(*f.topology, a); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		d := GetDataset(*f.dataset)
+		if d == nil {
+			return nil, nil, fmt.Errorf("unknown dataset %q, use \"ghostpipe list\" to see the available datasets", *f.dataset)
+		}
+		d.Build(a)
+	}
+
+	if *f.scenario != "" {
+		// Add the faults defined in the scenario file
+		if err := LoadScenario(*f.scenario, a); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	a.generateEventIDs()
+	return a, mon, nil
+}
+
+// writeGraphML save the graph of the architecture in GraphML format
+func writeGraphML(fileName string, a *Architecture) error {
+	gFile, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer gFile.Close()
+
+	fmt.Printf("Writing GraphML graph to %s\n", fileName)
+	return a.GraphML().Encode(gFile, true)
+}
+
+// writeCytoscapeJSON save the graph of the architecture in Cytoscape JSON format
+func writeCytoscapeJSON(fileName string, a *Architecture) error {
+	gFile, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer gFile.Close()
+
+	fmt.Printf("Writing Cytoscape graph to %s\n", fileName)
+	return a.CytoscapeJSON().Encode(gFile, true)
+}
+
+// graphFlags are the flags used to select the format and the options of the graph
+type graphFlags struct {
+	graphML   *string
+	cyjs      *string
+	directed  *bool
+	weights   *string
+	at        *string
+	intervals *bool
+}
+
+func addGraphFlags(fs *flag.FlagSet) *graphFlags {
+	return &graphFlags{
+		graphML:  fs.String("graphml", "graph.graphml", "File to save the graph in GraphML format"),
+		cyjs:     fs.String("cyjs", "graph.cyjs", "File to save the graph in Cytoscape JSON format"),
+		directed: fs.Bool("directed", false, "Export a directed graph, following the direction of the dependencies"),
+		weights:  fs.String("weights", "", "Weights of the edges by type (trigger, connect, DNSconnect, member, scheduled, hosted), like \"DNSconnect=0.2,connect=1\". By default 1"),
+		at:       fs.String("graph-at", "", "Export the topology as it was at this time of the simulation, like 36h"),
+		intervals: fs.Bool("graph-intervals", false,
+			"Export every node and edge that existed during the simulation, with its start and end times"),
+	}
+}
+
+// options return the options of the graph selected by the flags
+func (f *graphFlags) options() (GraphOptions, error) {
+	weights, err := parseWeights(*f.weights)
+	if err != nil {
+		return GraphOptions{}, err
+	}
+	options := GraphOptions{
+		Directed:  *f.directed,
+		Weights:   weights,
+		Intervals: *f.intervals,
+	}
+
+	if *f.at != "" {
+		at, err := parseDuration(*f.at)
+		if err != nil {
+			return GraphOptions{}, err
+		}
+		options.At = &at
+	}
+	return options, nil
+}
+
+// write save the graph of the architecture in the formats with a file name
+func (f *graphFlags) write(a *Architecture) error {
+	if *f.graphML != "" {
+		if err := writeGraphML(*f.graphML, a); err != nil {
+			return err
+		}
+	}
+	if *f.cyjs != "" {
+		if err := writeCytoscapeJSON(*f.cyjs, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWeights parse the weights of the edges, like "DNSconnect=0.2,connect=1"
+func parseWeights(s string) (map[EdgeType]float64, error) {
+	weights := make(map[EdgeType]float64)
+	if s == "" {
+		return weights, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weight %q, it should be type=weight", item)
+		}
+
+		typ := EdgeType(strings.TrimSpace(parts[0]))
+		switch typ {
+		case TriggerEdge, ConnectEdge, DNSConnectEdge, MemberEdge, ScheduledEdge, HostedEdge:
+		default:
+			return nil, fmt.Errorf("unknown edge type %q", typ)
+		}
+
+		w, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q for edge type %q", parts[1], typ)
+		}
+		weights[typ] = w
+	}
+	return weights, nil
+}
+
+func graphCommand(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	af := addArchitectureFlags(fs)
+	gf := addGraphFlags(fs)
+	durationFlag := fs.String("duration", "2d", "Simulated time to replay the changes of the topology for --graph-intervals")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	duration, err := parseDuration(*durationFlag)
+	if err != nil {
+		return err
+	}
+
+	a, _, err := af.build()
+	if err != nil {
+		return err
+	}
+
+	if a.GraphOptions, err = gf.options(); err != nil {
+		return err
+	}
+
+	// The topology at other time than the start is only known simulating the
+	// architecture. The events are discarded, the monitoring system has no sink.
+	if a.changing() && (a.GraphOptions.At != nil || a.GraphOptions.Intervals) {
+		if !a.GraphOptions.Intervals {
+			// A bit more, to apply also the changes at that time. The later
+			// ones are not exported.
+			duration = *a.GraphOptions.At + 1
+		}
+		fmt.Println("Simulating the changes of the topology...")
+		a.Start(duration)
+	}
+	return gf.write(a)
+}
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	af := addArchitectureFlags(fs)
+	gf := addGraphFlags(fs)
+	durationFlag := fs.String("duration", "2d", "Simulated time, like 90m, 36h, 2d or 1d12h. Without unit it is in minutes")
+	eventsFile := fs.String("events", "events.csv", "File to save the events in CSV format")
+	jsonlFile := fs.String("jsonl", "", "File to save the events in JSON lines format")
+	printEvents := fs.Bool("print", false, "Print the events to stdout as they are generated")
+	incidentsFile := fs.String("incidents", "incidents.csv", "File to save the injected incidents in CSV format")
+	metadataFile := fs.String("metadata", "metadata.json", "File to save the parameters of the simulation (seed, duration...)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	duration, err := parseDuration(*durationFlag)
+	if err != nil {
+		return err
+	}
+
+	a, mon, err := af.build()
+	if err != nil {
+		return err
+	}
+
+	if a.GraphOptions, err = gf.options(); err != nil {
+		return err
+	}
+
+	// Output the graph in different formats. If the architecture changes
+	// during the simulation, it is written at the end with all the changes.
+	if !a.changing() {
+		if err := gf.write(a); err != nil {
+			return err
+		}
+	}
+
+	// The events are written as they are generated
+	sink, err := openSinks(*eventsFile, *jsonlFile, *printEvents)
+	if err != nil {
+		return err
+	}
+	mon.Sink = sink
+	// Closed also if the simulation panics, to keep the events written until then
+	defer sink.Close()
+
+	// Start the simulation.
+	fmt.Println("Starting simulator...")
+
+	// Run the simulation for this long
+	a.Start(duration)
+	fmt.Println("Simulator finished")
+
+	if err := sink.Close(); err != nil {
+		return err
+	}
+
+	if a.changing() {
+		if err := gf.write(a); err != nil {
+			return err
+		}
+	}
+
+	// Write the ground truth of the injected faults
+	if *incidentsFile != "" {
+		fmt.Printf("Writing incidents to file %s\n", *incidentsFile)
+		if err := a.WriteIncidents(*incidentsFile); err != nil {
+			return err
+		}
+	}
+
+	if *metadataFile != "" {
+		fmt.Printf("Writing metadata to file %s\n", *metadataFile)
+		err := writeMetadata(*metadataFile, Metadata{
+			Seed:     af.seed.value,
+			Duration: duration,
+			Dataset:  *af.dataset,
+			Topology: *af.topology,
+			Scenario: *af.scenario,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scoreCommand(args []string) error {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	eventsFile := fs.String("events", "events.csv", "Events file generated by \"ghostpipe run\"")
+	clustersFile := fs.String("clusters", "clusters.csv",
+		"CSV file with the cluster of each event (columns eventid, cluster and optionally time and root_cause)")
+	incidentsFile := fs.String("incidents", "incidents.csv", "Incidents file generated by \"ghostpipe run\"")
+	jsonOutput := fs.Bool("json", false, "Print the score in JSON format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	events, err := readScoredEvents(*eventsFile)
+	if err != nil {
+		return err
+	}
+
+	err = readCSVFile(*clustersFile, func(r io.Reader) error {
+		return ReadClusters(r, events)
+	})
+	if err != nil {
+		return err
+	}
+
+	incidents, err := readIncidents(*incidentsFile)
+	if err != nil {
+		return err
+	}
+
+	score := ComputeScore(events, incidents)
+	if *jsonOutput {
+		return printJSON(score)
+	}
+	score.Print(os.Stdout)
+	return nil
+}
+
+// readScoredEvents read the problem events of an events file
+func readScoredEvents(fileName string) (events []*ScoredEvent, err error) {
+	err = readCSVFile(fileName, func(r io.Reader) error {
+		events, err = ReadScoredEvents(r)
+		return err
+	})
+	return events, err
+}
+
+// readIncidents read an incidents file
+func readIncidents(fileName string) (incidents []*Incident, err error) {
+	err = readCSVFile(fileName, func(r io.Reader) error {
+		incidents, err = ReadIncidents(r)
+		return err
+	})
+	return incidents, err
+}
+
+// printJSON print the value to stdout in JSON format
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// correlatorFlags are the flags used to configure the baseline correlators
+type correlatorFlags struct {
+	graphML  *string
+	window   *string
+	horizon  *string
+	distance *float64
+}
+
+func addCorrelatorFlags(fs *flag.FlagSet) *correlatorFlags {
+	return &correlatorFlags{
+		graphML:  fs.String("graphml", "graph.graphml", "Graph of the architecture in GraphML format"),
+		window:   fs.String("window", "5m", "Time window of the time-window and combined correlators"),
+		horizon:  fs.String("horizon", "1h", "Maximum time between the events grouped by the topology correlator"),
+		distance: fs.Float64("distance", 3, "Maximum distance in the graph between the alarms grouped by the topology and combined correlators"),
+	}
+}
+
+// correlators return the baseline correlators configured by the flags
+func (f *correlatorFlags) correlators() ([]Correlator, error) {
+	window, err := parseDuration(*f.window)
+	if err != nil {
+		return nil, err
+	}
+	horizon, err := parseDuration(*f.horizon)
+	if err != nil {
+		return nil, err
+	}
+
+	gFile, err := os.Open(*f.graphML)
+	if err != nil {
+		return nil, err
+	}
+	defer gFile.Close()
+
+	graph, err := ReadGraphML(gFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", *f.graphML, err)
+	}
+
+	// The durations are in minutes and the times of the events in seconds
+	return []Correlator{
+		&TimeWindowCorrelator{Window: window * 60},
+		&TopologyCorrelator{Graph: graph, MaxDistance: *f.distance, Horizon: horizon * 60},
+		&CombinedCorrelator{Graph: graph, Window: window * 60, MaxDistance: *f.distance},
+	}, nil
+}
+
+func correlateCommand(args []string) error {
+	fs := flag.NewFlagSet("correlate", flag.ContinueOnError)
+	cf := addCorrelatorFlags(fs)
+	method := fs.String("method", "combined", "Correlator to use: time-window, topology or combined")
+	eventsFile := fs.String("events", "events.csv", "Events file generated by \"ghostpipe run\"")
+	clustersFile := fs.String("clusters", "clusters.csv", "File to save the cluster of each event")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	correlators, err := cf.correlators()
+	if err != nil {
+		return err
+	}
+	var correlator Correlator
+	for _, c := range correlators {
+		if c.Name() == *method {
+			correlator = c
+		}
+	}
+	if correlator == nil {
+		return fmt.Errorf("unknown correlator %q", *method)
+	}
+
+	events, err := readScoredEvents(*eventsFile)
+	if err != nil {
+		return err
+	}
+	correlator.Correlate(events)
+
+	f, err := os.Create(*clustersFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Printf("Writing clusters to file %s\n", *clustersFile)
+	if err := WriteClusters(f, events); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// CorrelatorScore is the score of a baseline correlator in the report
+type CorrelatorScore struct {
+	Correlator string `json:"correlator"`
+	Score
+}
+
+func reportCommand(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	cf := addCorrelatorFlags(fs)
+	eventsFile := fs.String("events", "events.csv", "Events file generated by \"ghostpipe run\"")
+	incidentsFile := fs.String("incidents", "incidents.csv", "Incidents file generated by \"ghostpipe run\"")
+	jsonOutput := fs.Bool("json", false, "Print the report in JSON format")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	correlators, err := cf.correlators()
+	if err != nil {
+		return err
+	}
+	events, err := readScoredEvents(*eventsFile)
+	if err != nil {
+		return err
+	}
+	incidents, err := readIncidents(*incidentsFile)
+	if err != nil {
+		return err
+	}
+
+	report := []CorrelatorScore{}
+	for _, c := range correlators {
+		c.Correlate(events)
+		report = append(report, CorrelatorScore{c.Name(), ComputeScore(events, incidents)})
+	}
+
+	if *jsonOutput {
+		return printJSON(report)
+	}
+	PrintReport(os.Stdout, report)
+	return nil
+}
+
+// openSinks create the sinks where the events are written. Empty file names
+// are ignored.
+func openSinks(eventsFile, jsonlFile string, print bool) (EventSink, error) {
+	sinks := MultiSink{}
+
+	if eventsFile != "" {
+		fmt.Printf("Writing events to file %s\n", eventsFile)
+		s, err := NewCSVFileSink(eventsFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	if jsonlFile != "" {
+		fmt.Printf("Writing events to file %s\n", jsonlFile)
+		s, err := NewJSONLinesFileSink(jsonlFile)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	if print {
+		sinks = append(sinks, NewStdoutSink())
+	}
+
+	return sinks, nil
+}
+
+// Metadata stores the parameters needed to reproduce a simulation
+type Metadata struct {
+	Seed int64 `json:"seed"`
+	// Duration of the simulation in minutes
+	Duration float64 `json:"duration"`
+	Dataset  string  `json:"dataset,omitempty"`
+	Topology string  `json:"topology,omitempty"`
+	Scenario string  `json:"scenario,omitempty"`
+}
+
+// writeMetadata save the metadata of the simulation in JSON format
+func writeMetadata(fileName string, m Metadata) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+var durationRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)([dhms])`)
+
+// parseDuration parse a simulated time like "2d", "36h", "1d12h" or "90m"
+// returning it in minutes. A number without unit is in minutes. The duration
+// must be finite and greater than zero.
+func parseDuration(s string) (float64, error) {
+	minutes, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		units := map[string]float64{"d": 60 * 24, "h": 60, "m": 1, "s": 1.0 / 60}
+		minutes = 0
+		rest := s
+		for rest != "" {
+			m := durationRegexp.FindStringSubmatch(rest)
+			if m == nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			v, _ := strconv.ParseFloat(m[1], 64)
+			minutes += v * units[m[2]]
+			rest = rest[len(m[0]):]
+		}
+	}
+	if math.IsNaN(minutes) || math.IsInf(minutes, 0) || minutes <= 0 {
+		return 0, fmt.Errorf("invalid duration %q, it must be greater than zero", s)
+	}
+	return minutes, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]float64{
+		"90":    90,
+		"90m":   90,
+		"36h":   36 * 60,
+		"2d":    2 * 24 * 60,
+		"1d12h": 36 * 60,
+		"1.5h":  90,
+		"30s":   0.5,
+	} {
+		d, err := parseDuration(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+
+	for _, s := range []string{"", "2w", "d", "1d2", "0", "0h", "-5", "NaN", "Inf", "-Inf", "1e400"} {
+		_, err := parseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDatasetsRegistered(t *testing.T) {
+	for _, name := range []string{"MiniBackendFrontendNoise", "BackendFrontendNoise", "DBCluster", "RelacionesInesperadas", "MuchoRuidoPocasNueces", "PrimosLejanos", "NoMeAcuerdoNiDeMiNombre", "RecienNacido"} {
+		d := GetDataset(name)
+		if assert.NotNil(t, d, name) {
+			assert.NotEmpty(t, d.Description)
+		}
+	}
+	assert.NotNil(t, GetDataset(DefaultDataset))
+	assert.Nil(t, GetDataset("Unknown"))
+}
+
+func TestParseWeights(t *testing.T) {
+	weights, err := parseWeights("DNSconnect=0.2, connect=1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[EdgeType]float64{DNSConnectEdge: 0.2, ConnectEdge: 1}, weights)
+
+	weights, err = parseWeights("member=0.5,scheduled=2,hosted=3")
+	assert.NoError(t, err)
+	assert.Equal(t, map[EdgeType]float64{MemberEdge: 0.5, ScheduledEdge: 2, HostedEdge: 3}, weights)
+
+	weights, err = parseWeights("")
+	assert.NoError(t, err)
+	assert.Empty(t, weights)
+
+	for _, s := range []string{"DNSconnect", "unknown=1", "connect=x", "connect=-1"} {
+		_, err := parseWeights(s)
+		assert.Error(t, err, s)
+	}
+}
+
+// TestRunOutputsReproducible checks that the events generated with the same
+// seed don't depend on the graph formats exported
+func TestRunOutputsReproducible(t *testing.T) {
+	dir := t.TempDir()
+	run := func(name string, graphs ...string) []byte {
+		events := filepath.Join(dir, name+".csv")
+		args := append([]string{
+			"--dataset", "MiniBackendFrontendNoise", "--seed", "42", "--duration", "6h",
+			"--events", events, "--incidents", "", "--metadata", "",
+		}, graphs...)
+		assert.NoError(t, runCommand(args))
+		data, err := os.ReadFile(events)
+		assert.NoError(t, err)
+		return data
+	}
+
+	withGraphs := run("graphs", "--graphml", filepath.Join(dir, "graph.graphml"), "--cyjs", filepath.Join(dir, "graph.cyjs"))
+	withoutGraphs := run("nographs", "--graphml", "", "--cyjs", "")
+	assert.NotEmpty(t, withGraphs)
+	assert.Equal(t, string(withGraphs), string(withoutGraphs))
+}
+
+// TestGraphCommandChanges checks that the graph command applies the changes of
+// the architecture until the time of the graph
+func TestGraphCommandChanges(t *testing.T) {
+	graph := filepath.Join(t.TempDir(), "graph.cyjs")
+	assert.NoError(t, graphCommand([]string{"--dataset", "RecienNacido", "--seed", "1", "--graph-at", "36h", "--graphml", "", "--cyjs", graph}))
+	data, err := os.ReadFile(graph)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"name": "newdb"`)
+	assert.NotContains(t, string(data), `"name": "legacy0"`)
+}
+
+// TestRunOutputErrors checks that the errors writing the outputs are returned
+func TestRunOutputErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing", "file")
+	run := func(incidents, metadata string) error {
+		return runCommand([]string{
+			"--dataset", "MiniBackendFrontendNoise", "--seed", "42", "--duration", "1h",
+			"--events", filepath.Join(dir, "events.csv"), "--graphml", "", "--cyjs", "",
+			"--incidents", incidents, "--metadata", metadata,
+		})
+	}
+	assert.Error(t, run(missing, ""))
+	assert.Error(t, run("", missing))
+}
+
+// TestRunSeedZero checks that 0 is a seed like any other, and the run could be repeated
+func TestRunSeedZero(t *testing.T) {
+	dir := t.TempDir()
+	run := func(name string) ([]byte, []byte) {
+		events, metadata := filepath.Join(dir, name+".csv"), filepath.Join(dir, name+".json")
+		assert.NoError(t, runCommand([]string{
+			"--dataset", "MiniBackendFrontendNoise", "--seed", "0", "--duration", "6h",
+			"--events", events, "--graphml", "", "--cyjs", "", "--incidents", "", "--metadata", metadata,
+		}))
+		e, err := os.ReadFile(events)
+		assert.NoError(t, err)
+		m, err := os.ReadFile(metadata)
+		assert.NoError(t, err)
+		return e, m
+	}
+
+	events1, metadata := run("first")
+	events2, _ := run("second")
+	assert.NotEmpty(t, events1)
+	assert.Equal(t, string(events1), string(events2))
+	assert.Contains(t, string(metadata), `"seed": 0,`)
+}
@@ -0,0 +1,150 @@
+package main
+
+import "fmt"
+
+// Cluster is a group of servers of any type that work together, like the
+// nodes of a database or a consensus service. It is a node of the graph,
+// connected to its members, with the alarms of the cluster as a whole:
+//
+//   - ClusterDegraded (warning) while some member is not available
+//   - QuorumLost while less than Quorum members are available
+//   - SplitBrain, only triggered by faults, like a network partition
+//
+// The cluster is available while it has quorum and is not split.
+type Cluster struct {
+	Server
+	Members []Service
+	// Quorum is the number of available members needed. By default the
+	// majority of the members.
+	Quorum int
+
+	// status of the alarms of the cluster
+	status map[string]AlarmStatus
+}
+
+// NewCluster create a new cluster with the members and the quorum. quorum 0
+// is the majority of the members. It panics if there are no members.
+func NewCluster(name string, mon MonitorSystem, quorum int, members ...Service) *Cluster {
+	if len(members) == 0 {
+		panic(fmt.Sprintf("Cluster without members: %s", name))
+	}
+	c := &Cluster{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+		Members: members,
+		Quorum:  quorum,
+	}
+	c.SetSeverity("ClusterDegraded", SeverityWarning)
+	return c
+}
+
+// AddMember add the server to the cluster
+func (c *Cluster) AddMember(member Service) {
+	c.Members = append(c.Members, member)
+}
+
+// RemoveMember take the server out of the cluster
+func (c *Cluster) RemoveMember(member Service) {
+	for i, m := range c.Members {
+		if m == member {
+			c.Members = append(c.Members[:i], c.Members[i+1:]...)
+			return
+		}
+	}
+}
+
+// quorum return the number of members needed, the majority by default
+func (c *Cluster) quorum() int {
+	if c.Quorum <= 0 {
+		return len(c.Members)/2 + 1
+	}
+	return c.Quorum
+}
+
+func (c *Cluster) GetName() string {
+	return c.Name
+}
+
+// GetAlarms return only the alarms of the cluster, it is not a server by itself
+func (c *Cluster) GetAlarms() []string {
+	return []string{"ClusterDegraded", "QuorumLost", "SplitBrain"}
+}
+
+func (c *Cluster) GetType() string {
+	return string(ClusterNode)
+}
+
+// CheckAlarms update the alarms of the cluster with the number of members
+// available, using the cause of the first member down
+func (c *Cluster) CheckAlarms(t float64) {
+	if c.status == nil {
+		c.status = make(map[string]AlarmStatus)
+	}
+
+	available := 0
+	var down Service
+	for _, member := range c.Members {
+		if !c.noticeDown(member, t) {
+			available++
+		} else if down == nil {
+			down = member
+		}
+	}
+
+	// Without any member down, like when the last one is removed, there is
+	// no cause for the alarms
+	update := func(alarm string, ok bool) {
+		if ok || down == nil {
+			c.status[alarm] = AlarmEnabled
+		} else if c.status[alarm] == AlarmEnabled {
+			c.status[alarm] = AlarmTriggered
+			c.SetIncident(alarm, down.Cause())
+		}
+	}
+	update("ClusterDegraded", available == len(c.Members))
+	update("QuorumLost", available >= c.quorum())
+
+	for _, alarm := range c.GetAlarms() {
+		status := c.status[alarm]
+		c.checkAlarm(alarm, &status, t)
+		c.status[alarm] = status
+	}
+}
+
+// Available returns true if the cluster has quorum and it is not split
+func (c *Cluster) Available() bool {
+	return !c.failed("QuorumLost", c.status["QuorumLost"]) && !c.failed("SplitBrain", c.status["SplitBrain"])
+}
+
+// Cause returns the incident that made the cluster unavailable
+func (c *Cluster) Cause() string {
+	if c.failed("QuorumLost", c.status["QuorumLost"]) {
+		return c.incident("QuorumLost")
+	}
+	return c.incident("SplitBrain")
+}
+
+func (c *Cluster) SetAlarm(alarm string, status AlarmStatus) {
+	for _, a := range c.GetAlarms() {
+		if a == alarm {
+			if c.status == nil {
+				c.status = make(map[string]AlarmStatus)
+			}
+			c.status[alarm] = status
+			return
+		}
+	}
+	c.Server.SetAlarm(alarm, status)
+}
+
+// alarmStatus return the status of any alarm of the cluster
+func (c *Cluster) alarmStatus(alarm string) AlarmStatus {
+	for _, a := range c.GetAlarms() {
+		if a == alarm {
+			return c.status[alarm]
+		}
+	}
+	return c.Server.alarmStatus(alarm)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClusterQuorum checks that the cluster is degraded while some member is
+// down, and unavailable when it loses the quorum
+func TestClusterQuorum(t *testing.T) {
+	mon := &fakeMonSys{}
+	dbs := []*Database{}
+	members := []Service{}
+	for i := 0; i < 5; i++ {
+		db := &Database{Server: Server{Name: fmt.Sprintf("db%d", i), mon: mon}}
+		dbs = append(dbs, db)
+		members = append(members, db)
+	}
+	cluster := NewCluster("mariadb", mon, 0, members...)
+
+	time := 0.0
+	checkAll := func() {
+		for _, db := range dbs {
+			db.CheckAlarms(time)
+		}
+		cluster.CheckAlarms(time)
+		time++
+	}
+
+	dbs[1].PingAlarm = AlarmTriggered
+	dbs[1].SetIncident("Ping", "db1-down-0")
+	checkAll()
+	assert.Equal(t, []string{"0,db1,Ping", "0,mariadb,ClusterDegraded"}, mon.Alarms)
+	assert.Equal(t, SeverityWarning, mon.Events[1].Severity)
+	assert.True(t, cluster.Available())
+
+	// Two members down, the majority is still available
+	dbs[2].DBEngineAlarm = AlarmTriggered
+	checkAll()
+	assert.True(t, cluster.Available())
+
+	// Three members down, quorum lost
+	dbs[4].PingAlarm = AlarmTriggered
+	checkAll()
+	assert.Equal(t, []string{"0,db1,Ping", "0,mariadb,ClusterDegraded", "1,db2,DBEngine", "2,db4,Ping", "2,mariadb,QuorumLost"}, mon.Alarms)
+	assert.False(t, cluster.Available())
+	assert.Equal(t, "db1-down-0", cluster.Cause())
+
+	dbs[4].PingAlarm = AlarmEnabled
+	checkAll()
+	assert.True(t, cluster.Available())
+	last := mon.Events[len(mon.Events)-1]
+	assert.Equal(t, "mariadb", last.Server)
+	assert.Equal(t, "QuorumLost", last.Alarm)
+	assert.Equal(t, ResolvedState, last.State)
+}
+
+// TestClusterSplitBrain checks that a cluster with all its members is unavailable while it is split
+func TestClusterSplitBrain(t *testing.T) {
+	mon := &fakeMonSys{}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	srv2 := &Server{Name: "srv2", mon: mon}
+	cluster := NewCluster("etcd", mon, 1, srv1, srv2)
+
+	cluster.SetAlarm("SplitBrain", AlarmTriggered)
+	cluster.SetIncident("SplitBrain", "partition-0")
+	cluster.CheckAlarms(0)
+	assert.Equal(t, []string{"0,etcd,SplitBrain"}, mon.Alarms)
+	assert.False(t, cluster.Available())
+	assert.Equal(t, "partition-0", cluster.Cause())
+
+	// A client of the cluster notices it
+	kind := &ComponentKind{Name: "app", DependencyAlarms: []DependencyAlarm{{Alarm: "ClusterConnection"}}}
+	app := NewComponent("app1", kind, mon, cluster)
+	app.CheckAlarms(0)
+	assert.Equal(t, []string{"0,etcd,SplitBrain", "0,app1,ClusterConnection"}, mon.Alarms)
+	assert.Equal(t, "partition-0", mon.Events[1].Incident)
+}
+
+func TestTopologyCluster(t *testing.T) {
+	a := Architecture{mon: &PrinterMonitorSystem{Rand: rand.New(rand.NewSource(1))}}
+
+	topology := `databases:
+  - name: db
+    count: 3
+servers:
+  - name: zk
+    count: 3
+clusters:
+  - name: legacy
+    members: [db0, db1]
+  - name: zookeeper
+    members: [zk0, zk1, zk2]
+    quorum: 0
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+
+	assert.Len(t, a.Clusters, 1)
+	if assert.Len(t, a.QuorumClusters, 1) {
+		assert.Equal(t, "zookeeper", a.QuorumClusters[0].Name)
+		assert.Equal(t, 2, a.QuorumClusters[0].quorum())
+	}
+
+	// The cluster is a node linked to each member
+	nodes := []string{}
+	for _, n := range a.CytoscapeJSON().Elements.Nodes {
+		if n.Data["type"] == string(ClusterNode) || strings.HasPrefix(n.Data["name"].(string), "zookeeper-") {
+			nodes = append(nodes, n.Data["name"].(string))
+		}
+	}
+	assert.Equal(t, []string{"member:zookeeper-zk0", "member:zookeeper-zk1", "member:zookeeper-zk2"}, edgeLines(&a, MemberEdge))
+	assert.Equal(t, []string{"zookeeper", "zookeeper-ClusterDegraded", "zookeeper-QuorumLost", "zookeeper-SplitBrain"}, nodes)
+
+	// The removed members leave the cluster
+	a.RemoveServer("zk1")
+	assert.Len(t, a.QuorumClusters[0].Members, 2)
+	assert.Panics(t, func() { NewCluster("c1", &fakeMonSys{}, 0) })
+}
+
+// TestClusterRemoveMembers checks that the alarms of the cluster are resolved
+// when its last member is removed
+func TestClusterRemoveMembers(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	cluster := a.NewCluster("etcd", 0, srv1)
+
+	srv1.PingAlarm = AlarmTriggered
+	srv1.CheckAlarms(0)
+	cluster.CheckAlarms(0)
+	assert.False(t, cluster.Available())
+
+	a.RemoveServer("srv1")
+	cluster.CheckAlarms(1)
+	assert.True(t, cluster.Available())
+	assert.Equal(t, []string{
+		"0,srv1,Ping,problem,critical",
+		"0,etcd,ClusterDegraded,problem,warning",
+		"0,etcd,QuorumLost,problem,critical",
+		"1,etcd,ClusterDegraded,resolved,warning",
+		"1,etcd,QuorumLost,resolved,critical",
+	}, eventLines(mon))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComponentKind describes declaratively a kind of node: which alarms it has,
+// when it is available and which alarms are raised when its dependencies are
+// not available. New kinds of nodes could be added just defining a new kind,
+// without writing a new Go type.
+type ComponentKind struct {
+	// Name of the kind, used as the node type in the graph
+	Name string `yaml:"name"`
+	// Alarms of the component, besides the alarms of the base Server
+	Alarms []string `yaml:"alarms"`
+	// AvailableUnless are the alarms that make the component unavailable when
+	// triggered. Ping is always taken into account, like in the base Server.
+	AvailableUnless []string `yaml:"available_unless"`
+	// DependencyAlarms are the alarms raised when a dependency is not available
+	DependencyAlarms []DependencyAlarm `yaml:"dependency_alarms"`
+	// Severities is the severity of the alarms when they are triggered. Critical by default.
+	Severities map[string]Severity `yaml:"severities"`
+	// UnavailableSeverity is the minimum severity of the alarms in
+	// AvailableUnless (and Ping) that make the component unavailable. Critical by default.
+	UnavailableSeverity Severity `yaml:"unavailable_severity"`
+
+	line int
+}
+
+func (k *ComponentKind) UnmarshalYAML(value *yaml.Node) error {
+	type plain ComponentKind
+	k.line = value.Line
+	return value.Decode((*plain)(k))
+}
+
+// validate check that the kind has a name and that the alarms in
+// AvailableUnless are alarms of the kind or of the base Server
+func (k *ComponentKind) validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("kind without name")
+	}
+	alarms := make(map[string]bool)
+	for _, alarm := range (&Server{}).GetAlarms() {
+		alarms[alarm] = true
+	}
+	for _, alarm := range k.Alarms {
+		alarms[alarm] = true
+	}
+	for _, d := range k.DependencyAlarms {
+		alarms[d.Alarm] = true
+	}
+	for _, alarm := range k.AvailableUnless {
+		if !alarms[alarm] {
+			return fmt.Errorf("kind %q available unless unknown alarm %q", k.Name, alarm)
+		}
+	}
+	return nil
+}
+
+// DependencyAlarm raise Alarm while a dependency matching Dependency is not available
+type DependencyAlarm struct {
+	Alarm string `yaml:"alarm"`
+	// Dependency is the name or the type of the dependencies watched by this
+	// alarm. Empty to watch all the dependencies.
+	Dependency string `yaml:"dependency"`
+}
+
+// matches return true if the dependency is watched by the rule
+func (d DependencyAlarm) matches(dependency Service) bool {
+	return d.Dependency == "" || d.Dependency == dependency.GetName() || d.Dependency == dependency.GetType()
+}
+
+// Component is a server whose alarms and behaviour are defined by its kind
+type Component struct {
+	Server
+	Kind         *ComponentKind
+	Dependencies []Service
+
+	// status of the alarms defined by the kind
+	status map[string]AlarmStatus
+}
+
+// NewComponent create a new component of the given kind. The component has
+// its own copy of the severities of the kind.
+func NewComponent(name string, kind *ComponentKind, mon MonitorSystem, dependencies ...Service) *Component {
+	severities := make(map[string]Severity, len(kind.Severities))
+	for alarm, severity := range kind.Severities {
+		severities[alarm] = severity
+	}
+	return &Component{
+		Server: Server{
+			Name:                name,
+			mon:                 mon,
+			Severities:          severities,
+			UnavailableSeverity: kind.UnavailableSeverity,
+		},
+		Kind:         kind,
+		Dependencies: dependencies,
+	}
+}
+
+func (c *Component) GetName() string {
+	return c.Name
+}
+
+func (c *Component) GetType() string {
+	return c.Kind.Name
+}
+
+func (c *Component) GetAlarms() []string {
+	alarms := c.Server.GetAlarms()
+	for _, alarm := range c.kindAlarms() {
+		if !c.isServerAlarm(alarm) {
+			alarms = append(alarms, alarm)
+		}
+	}
+	return alarms
+}
+
+// kindAlarms return the alarms defined by the kind, including the ones
+// derived from the dependencies, without duplicates
+func (c *Component) kindAlarms() []string {
+	seen := make(map[string]bool)
+	alarms := []string{}
+	add := func(alarm string) {
+		if !seen[alarm] {
+			seen[alarm] = true
+			alarms = append(alarms, alarm)
+		}
+	}
+
+	for _, alarm := range c.Kind.Alarms {
+		add(alarm)
+	}
+	for _, d := range c.Kind.DependencyAlarms {
+		add(d.Alarm)
+	}
+	return alarms
+}
+
+func (c *Component) isServerAlarm(alarm string) bool {
+	for _, a := range c.Server.GetAlarms() {
+		if a == alarm {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAlarms print a message for the alarms of the kind that have changed,
+// updating first the alarms derived from the dependencies, and then check the
+// alarms of the base server.
+func (c *Component) CheckAlarms(t float64) {
+	if c.status == nil {
+		c.status = make(map[string]AlarmStatus)
+	}
+
+	for _, rule := range c.Kind.DependencyAlarms {
+		var down Service
+		for _, dependency := range c.Dependencies {
+			if rule.matches(dependency) && c.noticeDown(dependency, t) {
+				down = dependency
+				break
+			}
+		}
+
+		if down == nil {
+			c.status[rule.Alarm] = AlarmEnabled
+		} else if c.status[rule.Alarm] == AlarmEnabled {
+			c.status[rule.Alarm] = AlarmTriggered
+			c.SetIncident(rule.Alarm, down.Cause())
+		}
+	}
+
+	for _, alarm := range c.kindAlarms() {
+		if c.isServerAlarm(alarm) {
+			continue
+		}
+		status := c.status[alarm]
+		c.checkAlarm(alarm, &status, t)
+		c.status[alarm] = status
+	}
+
+	c.Server.CheckAlarms(t)
+}
+
+// Available returns true if the server is available and none of the alarms
+// in AvailableUnless is triggered
+func (c *Component) Available() bool {
+	if !c.Server.Available() {
+		return false
+	}
+	for _, alarm := range c.Kind.AvailableUnless {
+		if c.failed(alarm, c.alarmStatus(alarm)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Cause returns the incident that made the component unavailable
+func (c *Component) Cause() string {
+	if !c.Server.Available() {
+		return c.Server.Cause()
+	}
+	for _, alarm := range c.Kind.AvailableUnless {
+		if c.failed(alarm, c.alarmStatus(alarm)) {
+			return c.incident(alarm)
+		}
+	}
+	return NoiseIncident
+}
+
+func (c *Component) SetAlarm(alarm string, status AlarmStatus) {
+	if c.isServerAlarm(alarm) {
+		c.Server.SetAlarm(alarm, status)
+		return
+	}
+
+	for _, a := range c.kindAlarms() {
+		if a == alarm {
+			if c.status == nil {
+				c.status = make(map[string]AlarmStatus)
+			}
+			c.status[alarm] = status
+			return
+		}
+	}
+	panic(fmt.Sprintf("Unknown alarm: %s", alarm))
+}
+
+// alarmStatus return the status of any alarm of the component
+func (c *Component) alarmStatus(alarm string) AlarmStatus {
+	if c.isServerAlarm(alarm) {
+		return c.Server.alarmStatus(alarm)
+	}
+	return c.status[alarm]
+}
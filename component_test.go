@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var cacheKind = &ComponentKind{
+	Name:            "cache",
+	Alarms:          []string{"Proc", "Evictions"},
+	AvailableUnless: []string{"Proc"},
+	DependencyAlarms: []DependencyAlarm{
+		{Alarm: "DBConnection", Dependency: "db"},
+	},
+}
+
+func TestComponentAlarms(t *testing.T) {
+	c := NewComponent("cache1", cacheKind, &fakeMonSys{})
+
+	assert.Equal(t, []string{"CPU", "Memory", "Disk", "Ping", "DNS", "Proc", "Evictions", "DBConnection"}, c.GetAlarms())
+	assert.Equal(t, "cache", c.GetType())
+	assert.Panics(t, func() { c.SetAlarm("Unknown", AlarmTriggered) })
+}
+
+func TestComponentAvailability(t *testing.T) {
+	c := NewComponent("cache1", cacheKind, &fakeMonSys{})
+	assert.True(t, c.Available())
+
+	// Alarms not in AvailableUnless do not affect the availability
+	c.SetAlarm("Evictions", AlarmTriggered)
+	assert.True(t, c.Available())
+
+	c.SetAlarm("Proc", AlarmTriggered)
+	c.SetIncident("Proc", "cache-down-0")
+	assert.False(t, c.Available())
+	assert.Equal(t, "cache-down-0", c.Cause())
+
+	c.SetAlarm("Proc", AlarmEnabled)
+	c.SetAlarm("Ping", AlarmTriggered)
+	assert.False(t, c.Available())
+}
+
+// TestComponentSeverities checks that each component has its own severities,
+// starting with the ones of its kind
+func TestComponentSeverities(t *testing.T) {
+	kind := &ComponentKind{Name: "queue", Alarms: []string{"Lag"}, Severities: map[string]Severity{"Lag": SeverityWarning}}
+	q1 := NewComponent("queue1", kind, &fakeMonSys{})
+	q2 := NewComponent("queue2", kind, &fakeMonSys{})
+
+	q1.SetSeverity("Lag", SeverityInfo)
+	assert.Equal(t, SeverityInfo, q1.BaseSeverity("Lag"))
+	assert.Equal(t, SeverityWarning, q2.BaseSeverity("Lag"))
+	assert.Equal(t, SeverityWarning, kind.Severities["Lag"])
+}
+
+func TestDBDownAffectComponent(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	c := NewComponent("cache1", cacheKind, mon, db1)
+	frontend1 := NewComponent("frontend1", &ComponentKind{
+		Name:             "web",
+		DependencyAlarms: []DependencyAlarm{{Alarm: "CacheConnection"}},
+	}, mon, c)
+
+	db1.SetAlarm("DBEngine", AlarmTriggered)
+	db1.CheckAlarms(0)
+	c.CheckAlarms(0)
+	frontend1.CheckAlarms(0)
+
+	// The cache is still available, so frontend1 does not raise any alarm
+	assert.Equal(t, []string{"0,db1,DBEngine", "0,cache1,DBConnection"}, mon.Alarms)
+
+	c.SetAlarm("Proc", AlarmTriggered)
+	c.CheckAlarms(1)
+	frontend1.CheckAlarms(1)
+	assert.Equal(t, []string{"0,db1,DBEngine", "0,cache1,DBConnection", "1,cache1,Proc", "1,frontend1,CacheConnection"}, mon.Alarms)
+}
+
+func TestTopologyComponents(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `kinds:
+  - name: cache
+    alarms: [Proc]
+    dependency_alarms:
+      - alarm: DBConnection
+databases:
+  - name: db1
+components:
+  - name: web
+    kind: cache
+    depends_on: [cache]
+  - name: cache
+    kind: cache
+    depends_on: [db1]
+  - name: other
+    kind: cache
+    depends_on: [db2]
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:15: component "other" references unknown dependency "db2"`)
+
+	assert.Len(t, a.Components, 3)
+	assert.Equal(t, []Service{a.Components[1]}, a.Components[0].Dependencies)
+	assert.Equal(t, []Service{a.DBs[0]}, a.Components[1].Dependencies)
+}
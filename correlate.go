@@ -0,0 +1,301 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/yaricom/goGraphML/graphml"
+)
+
+// Correlator groups the events in clusters, like the external correlators
+// evaluated with "ghostpipe score". The baseline correlators are used to know
+// how much signal a dataset contains.
+type Correlator interface {
+	Name() string
+	// Correlate set the Cluster of each event, and mark the root cause of each cluster
+	Correlate(events []*ScoredEvent)
+}
+
+// TopologyGraph is the graph of the architecture read from a GraphML file,
+// as written by Architecture.GraphML(). It is used to compute the distance
+// between the alarms of the events.
+type TopologyGraph struct {
+	// adjacency has the edges of each node, by position
+	adjacency [][]topologyEdge
+	// alarms has the node of each event id, servers the node of each server name
+	alarms  map[int]int
+	servers map[string]int
+	// distances from a node to the rest, computed when needed
+	distances map[int][]float64
+}
+
+type topologyEdge struct {
+	to     int
+	weight float64
+}
+
+// ReadGraphML read a graph in GraphML format. The edges are used in both
+// directions, even if the graph is directed, and with their weight if they
+// have one. Alarm nodes are identified by their "id" attribute, that is the
+// eventid of their events.
+func ReadGraphML(r io.Reader) (*TopologyGraph, error) {
+	// Decode the XML directly, the decoded nodes of graphml do not give access
+	// to their attributes
+	gm := &graphml.GraphML{}
+	if err := xml.NewDecoder(r).Decode(gm); err != nil {
+		return nil, err
+	}
+	if len(gm.Graphs) == 0 {
+		return nil, fmt.Errorf("no graph found")
+	}
+
+	keys := make(map[string]string)
+	for _, k := range gm.Keys {
+		keys[k.ID] = k.Name
+	}
+	attributes := func(data []*graphml.Data) map[string]string {
+		attrs := make(map[string]string)
+		for _, d := range data {
+			attrs[keys[d.Key]] = d.Value
+		}
+		return attrs
+	}
+
+	g := &TopologyGraph{
+		alarms:    make(map[int]int),
+		servers:   make(map[string]int),
+		distances: make(map[int][]float64),
+	}
+	nodes := make(map[string]int)
+	graph := gm.Graphs[0]
+	for i, n := range graph.Nodes {
+		nodes[n.ID] = i
+		attrs := attributes(n.Data)
+		if attrs["type"] == string(AlarmNode) {
+			if id, err := strconv.Atoi(attrs["id"]); err == nil {
+				g.alarms[id] = i
+			}
+		} else {
+			g.servers[attrs["name"]] = i
+		}
+	}
+
+	g.adjacency = make([][]topologyEdge, len(graph.Nodes))
+	for _, e := range graph.Edges {
+		source, ok := nodes[e.Source]
+		if !ok {
+			return nil, fmt.Errorf("edge %q with unknown source %q", e.ID, e.Source)
+		}
+		target, ok := nodes[e.Target]
+		if !ok {
+			return nil, fmt.Errorf("edge %q with unknown target %q", e.ID, e.Target)
+		}
+
+		weight := 1.0
+		if w, ok := attributes(e.Data)["weight"]; ok {
+			var err error
+			if weight, err = strconv.ParseFloat(w, 64); err != nil {
+				return nil, fmt.Errorf("edge %q with invalid weight %q", e.ID, w)
+			}
+		}
+		g.adjacency[source] = append(g.adjacency[source], topologyEdge{target, weight})
+		g.adjacency[target] = append(g.adjacency[target], topologyEdge{source, weight})
+	}
+
+	return g, nil
+}
+
+// node return the node of the alarm of the event, or of its server if the
+// alarm is not in the graph
+func (g *TopologyGraph) node(e *ScoredEvent) (int, bool) {
+	if n, ok := g.alarms[e.EventID]; ok {
+		return n, true
+	}
+	n, ok := g.servers[e.Server]
+	return n, ok
+}
+
+// Distance return the length of the shortest path between the alarms of the
+// events. Infinite if they are not connected or not in the graph.
+func (g *TopologyGraph) Distance(a, b *ScoredEvent) float64 {
+	source, ok := g.node(a)
+	if !ok {
+		return math.Inf(1)
+	}
+	target, ok := g.node(b)
+	if !ok {
+		return math.Inf(1)
+	}
+
+	if _, ok := g.distances[source]; !ok {
+		g.distances[source] = g.shortestPaths(source)
+	}
+	return g.distances[source][target]
+}
+
+// shortestPaths compute the distance from the node to the rest (Dijkstra)
+func (g *TopologyGraph) shortestPaths(source int) []float64 {
+	dist := make([]float64, len(g.adjacency))
+	for i := range dist {
+		dist[i] = math.Inf(1)
+	}
+	dist[source] = 0
+
+	q := &distanceQueue{{source, 0}}
+	for q.Len() > 0 {
+		item := heap.Pop(q).(topologyEdge)
+		if item.weight > dist[item.to] {
+			continue
+		}
+		for _, e := range g.adjacency[item.to] {
+			if d := item.weight + e.weight; d < dist[e.to] {
+				dist[e.to] = d
+				heap.Push(q, topologyEdge{e.to, d})
+			}
+		}
+	}
+	return dist
+}
+
+// distanceQueue is a priority queue of nodes (to) by distance (weight)
+type distanceQueue []topologyEdge
+
+func (q distanceQueue) Len() int            { return len(q) }
+func (q distanceQueue) Less(i, j int) bool  { return q[i].weight < q[j].weight }
+func (q distanceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *distanceQueue) Push(x interface{}) { *q = append(*q, x.(topologyEdge)) }
+func (q *distanceQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// TimeWindowCorrelator groups the events by time only. Each cluster starts
+// with an event and has all the events of the next Window seconds.
+type TimeWindowCorrelator struct {
+	Window float64
+}
+
+func (c *TimeWindowCorrelator) Name() string { return "time-window" }
+
+func (c *TimeWindowCorrelator) Correlate(events []*ScoredEvent) {
+	sorted := sortedEvents(events)
+	clusters := make([]int, len(sorted))
+	cluster, start := -1, 0.0
+	for i, e := range sorted {
+		if cluster < 0 || e.Time-start > c.Window {
+			cluster, start = i, e.Time
+		}
+		clusters[i] = cluster
+	}
+	setClusters(sorted, clusters)
+}
+
+// TopologyCorrelator groups the events whose alarms are at most MaxDistance
+// apart in the graph. Only events less than Horizon seconds apart are
+// compared, to not group the failures of different days.
+type TopologyCorrelator struct {
+	Graph       *TopologyGraph
+	MaxDistance float64
+	Horizon     float64
+}
+
+func (c *TopologyCorrelator) Name() string { return "topology" }
+
+func (c *TopologyCorrelator) Correlate(events []*ScoredEvent) {
+	linkEvents(events, c.Horizon, func(a, b *ScoredEvent) bool {
+		return c.Graph.Distance(a, b) <= c.MaxDistance
+	})
+}
+
+// CombinedCorrelator groups the events less than Window seconds apart whose
+// alarms are at most MaxDistance apart in the graph.
+type CombinedCorrelator struct {
+	Graph       *TopologyGraph
+	Window      float64
+	MaxDistance float64
+}
+
+func (c *CombinedCorrelator) Name() string { return "combined" }
+
+func (c *CombinedCorrelator) Correlate(events []*ScoredEvent) {
+	linkEvents(events, c.Window, func(a, b *ScoredEvent) bool {
+		return c.Graph.Distance(a, b) <= c.MaxDistance
+	})
+}
+
+// sortedEvents return a copy of the events sorted by time
+func sortedEvents(events []*ScoredEvent) []*ScoredEvent {
+	sorted := append([]*ScoredEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time < sorted[j].Time })
+	return sorted
+}
+
+// linkEvents group the events linked, directly or through other events. Only
+// events less than window seconds apart are compared.
+func linkEvents(events []*ScoredEvent, window float64, linked func(a, b *ScoredEvent) bool) {
+	sorted := sortedEvents(events)
+
+	// Union-find of the positions of the events
+	parent := make([]int, len(sorted))
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i, e := range sorted {
+		parent[i] = i
+		for j := i - 1; j >= 0 && e.Time-sorted[j].Time <= window; j-- {
+			if linked(sorted[j], e) {
+				// The root is always the first event of the cluster
+				ri, rj := find(i), find(j)
+				if ri < rj {
+					parent[rj] = ri
+				} else {
+					parent[ri] = rj
+				}
+			}
+		}
+	}
+
+	clusters := make([]int, len(sorted))
+	for i := range sorted {
+		clusters[i] = find(i)
+	}
+	setClusters(sorted, clusters)
+}
+
+// setClusters name the clusters of the events sorted by time, from the
+// position of their first event, that is marked as the root cause
+func setClusters(sorted []*ScoredEvent, clusters []int) {
+	for i, e := range sorted {
+		e.Cluster = fmt.Sprintf("c%d", clusters[i])
+		e.RootCause = clusters[i] == i
+	}
+}
+
+// WriteClusters save the cluster of each event in the CSV format read by
+// "ghostpipe score"
+func WriteClusters(w io.Writer, events []*ScoredEvent) error {
+	if _, err := fmt.Fprintln(w, "eventid,cluster,time,root_cause"); err != nil {
+		return err
+	}
+	for _, e := range events {
+		if e.Cluster == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%d,%s,%.0f,%t\n", e.EventID, e.Cluster, e.Time, e.RootCause); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func correlateGraph(t *testing.T) *TopologyGraph {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	a.AddServer(&Server{Name: "srv1"})
+	a.AddDB(db1)
+	a.AddBackend(backend1)
+	a.AddFrontend(&Frontend{Server: Server{Name: "frontend1", mon: mon}, Backend: backend1})
+
+	var buf bytes.Buffer
+	assert.NoError(t, a.GraphML().Encode(&buf, false))
+	g, err := ReadGraphML(&buf)
+	assert.NoError(t, err)
+	return g
+}
+
+func correlateEvents() []*ScoredEvent {
+	return []*ScoredEvent{
+		{Time: 0, Server: "db1", Alarm: "Ping", EventID: 204},
+		{Time: 60, Server: "backend1", Alarm: "DBConnection", EventID: 307},
+		{Time: 90, Server: "srv1", Alarm: "CPU", EventID: 101},
+		{Time: 120, Server: "frontend1", Alarm: "BackendConnection", EventID: 408},
+		{Time: 7200, Server: "db1", Alarm: "Ping", EventID: 204},
+	}
+}
+
+func clustersOf(events []*ScoredEvent) []string {
+	clusters := []string{}
+	for _, e := range events {
+		clusters = append(clusters, e.Cluster)
+	}
+	return clusters
+}
+
+func TestReadGraphMLDistance(t *testing.T) {
+	g := correlateGraph(t)
+	events := correlateEvents()
+
+	// Alarm -> server -> server -> alarm
+	assert.Equal(t, 3.0, g.Distance(events[0], events[1]))
+	assert.Equal(t, 4.0, g.Distance(events[0], events[3]))
+	assert.Equal(t, 0.0, g.Distance(events[0], events[4]))
+	assert.True(t, math.IsInf(g.Distance(events[0], events[2]), 1))
+
+	// Events of alarms not in the graph use their server
+	unknown := &ScoredEvent{Server: "db1", Alarm: "Other", EventID: 999}
+	assert.Equal(t, 2.0, g.Distance(unknown, events[1]))
+}
+
+func TestTimeWindowCorrelator(t *testing.T) {
+	events := correlateEvents()
+	(&TimeWindowCorrelator{Window: 300}).Correlate(events)
+
+	assert.Equal(t, []string{"c0", "c0", "c0", "c0", "c4"}, clustersOf(events))
+	assert.True(t, events[0].RootCause)
+	assert.False(t, events[1].RootCause)
+	assert.True(t, events[4].RootCause)
+}
+
+func TestTopologyCorrelators(t *testing.T) {
+	g := correlateGraph(t)
+
+	events := correlateEvents()
+	(&TopologyCorrelator{Graph: g, MaxDistance: 3, Horizon: 3600}).Correlate(events)
+	assert.Equal(t, []string{"c0", "c0", "c2", "c0", "c4"}, clustersOf(events))
+
+	// The frontend event is too late to be grouped with the db one
+	events = correlateEvents()
+	(&CombinedCorrelator{Graph: g, Window: 30, MaxDistance: 4}).Correlate(events)
+	assert.Equal(t, []string{"c0", "c1", "c2", "c3", "c4"}, clustersOf(events))
+
+	events = correlateEvents()
+	(&CombinedCorrelator{Graph: g, Window: 60, MaxDistance: 3}).Correlate(events)
+	assert.Equal(t, []string{"c0", "c0", "c2", "c0", "c4"}, clustersOf(events))
+
+	// The clusters written can be scored
+	var buf bytes.Buffer
+	assert.NoError(t, WriteClusters(&buf, events))
+	scored := correlateEvents()
+	assert.NoError(t, ReadClusters(&buf, scored))
+	assert.Equal(t, clustersOf(events), clustersOf(scored))
+}
@@ -32,10 +32,7 @@ func (s *Database) GetType() string {
 // CheckAlarms print a message if the database engines is not working
 // or the base server has alarms.
 func (d *Database) CheckAlarms(t float64) {
-	if d.DBEngineAlarm == AlarmTriggered {
-		d.DBEngineAlarm = AlarmACK
-		d.mon.handleAlarm(d.Name, "DBEngine", t)
-	}
+	d.checkAlarm("DBEngine", &d.DBEngineAlarm, t)
 
 	d.Server.CheckAlarms(t)
 }
@@ -43,14 +40,30 @@ func (d *Database) CheckAlarms(t float64) {
 // Available return true if the db server is considered available, that is,
 // if the db engine is available and the server is available.
 func (d *Database) Available() bool {
-	return d.Server.Available() && d.DBEngineAlarm == AlarmEnabled
+	return d.Server.Available() && !d.failed("DBEngine", d.DBEngineAlarm)
+}
+
+// Cause returns the incident that made the db server unavailable
+func (d *Database) Cause() string {
+	if !d.Server.Available() {
+		return d.Server.Cause()
+	}
+	return d.incident("DBEngine")
 }
 
 func (d *Database) SetAlarm(alarm string, status AlarmStatus) {
 	switch alarm {
 	case "DBEngine":
-		d.DBEngineAlarm = AlarmTriggered
+		d.DBEngineAlarm = status
 	default:
 		d.Server.SetAlarm(alarm, status)
 	}
 }
+
+// alarmStatus return the status of any alarm of the database
+func (d *Database) alarmStatus(alarm string) AlarmStatus {
+	if alarm == "DBEngine" {
+		return d.DBEngineAlarm
+	}
+	return d.Server.alarmStatus(alarm)
+}
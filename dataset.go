@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Dataset is a predefined architecture, with its servers and faults, that
+// could be selected by name from the command line
+type Dataset struct {
+	Name        string
+	Description string
+	// Build add the servers and the faults of the dataset to the architecture
+	Build func(*Architecture)
+}
+
+// datasets registered by name
+var datasets = make(map[string]*Dataset)
+
+// RegisterDataset add a dataset to the registry. It should be called from an
+// init function in the file of the dataset.
+func RegisterDataset(name string, description string, build func(*Architecture)) {
+	if _, ok := datasets[name]; ok {
+		panic(fmt.Sprintf("Dataset already registered: %s", name))
+	}
+	datasets[name] = &Dataset{
+		Name:        name,
+		Description: description,
+		Build:       build,
+	}
+}
+
+// GetDataset return the dataset with that name or nil if it is not registered
+func GetDataset(name string) *Dataset {
+	return datasets[name]
+}
+
+// Datasets return all the registered datasets sorted by name
+func Datasets() []*Dataset {
+	list := make([]*Dataset, 0, len(datasets))
+	for _, d := range datasets {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
-
-	"github.com/fschuetz04/simgo"
+	"sort"
 )
 
+func init() {
+	RegisterDataset("DBCluster", "Varios clusters de distintas tecnologías y ruido. Cuando salta una alarma en un nodo de un cluster, salta en todos", DBCluster)
+}
+
 // DBCluster simula varios clusters de servidores donde cuando se
 // cae la alarma de disco se cae para todas. Igual para la CPU y memoria
 func DBCluster(a *Architecture) {
@@ -20,7 +22,15 @@ func DBCluster(a *Architecture) {
 	}
 	clusters := make(map[string][]*Database, len(clusterSize))
 
-	for tech, size := range clusterSize {
+	// Iterate the technologies in order, so the simulation is reproducible
+	techs := make([]string, 0, len(clusterSize))
+	for tech := range clusterSize {
+		techs = append(techs, tech)
+	}
+	sort.Strings(techs)
+
+	for _, tech := range techs {
+		size := clusterSize[tech]
 		clusters[tech] = make([]*Database, size)
 		for i := 0; i < size; i++ {
 			clusters[tech][i] = a.NewDatabase(fmt.Sprintf("%s-%d", tech, i))
@@ -29,36 +39,36 @@ func DBCluster(a *Architecture) {
 		// Esta llamada busca crear los edges entre los servidores
 		a.NewClusterDB(clusters[tech])
 
-		t := tech // Copia de la variable para que no se vea modificada por el loop al crear el func literal
+		members := make([]string, len(clusters[tech]))
+		for i, db := range clusters[tech] {
+			members[i] = db.Name
+		}
 
 		// Simulamos una subida de carga, que dispara la alama de CPU en todos los servidores
-		a.AddMonkey(func(proc simgo.Process) {
-			for {
-				proc.Wait(proc.Timeout(float64(100 + rand.Intn(400))))
-				for _, db := range clusters[t] {
-					db.CPUAlarm = AlarmTriggered
-				}
-			}
+		a.AddFault(&Fault{
+			Name:    tech + "-cpu",
+			Targets: members,
+			Alarm:   "CPU",
+			Start:   Uniform(100, 500),
+			Period:  Uniform(100, 500),
 		})
 
 		// Simulamos una subida de carga, que dispara la alama de memoria en todos los servidores
-		a.AddMonkey(func(proc simgo.Process) {
-			for {
-				proc.Wait(proc.Timeout(float64(100 + rand.Intn(700))))
-				for _, db := range clusters[t] {
-					db.MemoryAlarm = AlarmTriggered
-				}
-			}
+		a.AddFault(&Fault{
+			Name:    tech + "-memory",
+			Targets: members,
+			Alarm:   "Memory",
+			Start:   Uniform(100, 800),
+			Period:  Uniform(100, 800),
 		})
 
 		// Simulamos un llenado de disco
-		a.AddMonkey(func(proc simgo.Process) {
-			for {
-				proc.Wait(proc.Timeout(float64(100 + rand.Intn(1200))))
-				for _, db := range clusters[t] {
-					db.DiskAlarm = AlarmTriggered
-				}
-			}
+		a.AddFault(&Fault{
+			Name:    tech + "-disk",
+			Targets: members,
+			Alarm:   "Disk",
+			Start:   Uniform(100, 1300),
+			Period:  Uniform(100, 1300),
 		})
 	}
 
@@ -68,25 +78,6 @@ func DBCluster(a *Architecture) {
 		noiseServers = append(noiseServers, a.NewServer("noise"+fmt.Sprintf("%d", i)))
 	}
 
-	// Generate alarm noise
-	a.AddMonkey(func(proc simgo.Process) {
-		for {
-			// Get one of the noise servers
-			noiseServer := noiseServers[rand.Intn(len(noiseServers))]
-
-			// Trigger one the alarms of the server
-			switch rand.Intn(4) {
-			case 0:
-				noiseServer.CPUAlarm = AlarmTriggered
-			case 1:
-				noiseServer.MemoryAlarm = AlarmTriggered
-			case 2:
-				noiseServer.DiskAlarm = AlarmTriggered
-			case 3:
-				noiseServer.PingAlarm = AlarmTriggered
-			}
-
-			proc.Wait(proc.Timeout(1))
-		}
-	})
+	// Generate alarm noise: each minute trigger one of the alarms of one of the noise servers
+	a.AddFault(NoiseFault(noiseServers))
 }
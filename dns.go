@@ -1,14 +1,21 @@
 package main
 
-// Frontend represents a frontend server with its possible alarms and connected to a backend.
+// DNS represents a DNS server and the servers that use it to resolve names.
 type DNS struct {
 	Server
 	// ProcAlarm is True if the DNS process is not running
 	ProcAlarm AlarmStatus
 	Clients   []MonitoredServer
+
+	// down store the trigger of the DNS alarm of each client that noticed
+	// this server down
+	down map[MonitoredServer]int
+	// arch is the architecture of the DNS server, to raise the DNS alarm of
+	// the clients along with the faults and other DNS servers
+	arch *Architecture
 }
 
-// NewFrontend create a new Frontend server, start it and return the pointer to it
+// NewDNS create a new DNS server and return the pointer to it
 func NewDNS(name string, mon MonitorSystem) *DNS {
 	return &DNS{
 		Server: Server{
@@ -22,6 +29,16 @@ func (b *DNS) AddClient(client MonitoredServer) {
 	b.Clients = append(b.Clients, client)
 }
 
+// RemoveClient stop using the DNS server in the client
+func (b *DNS) RemoveClient(client MonitoredServer) {
+	for i, c := range b.Clients {
+		if c == client {
+			b.Clients = append(b.Clients[:i], b.Clients[i+1:]...)
+			return
+		}
+	}
+}
+
 func (b *DNS) GetName() string {
 	return b.Name
 }
@@ -36,24 +53,44 @@ func (s *DNS) GetType() string {
 }
 
 // CheckAlarms print a message if the server has alarms.
-// Trigger the DNS alarm in all the connectected clients.
+// Trigger the DNS alarm in all the connectected clients when they notice
+// that the DNS server is not available, and clear it when it is available again.
 func (b *DNS) CheckAlarms(t float64) {
-	if b.ProcAlarm == AlarmTriggered {
-		b.ProcAlarm = AlarmACK
-		b.mon.handleAlarm(b.Name, "Proc", t)
-
-		for _, client := range b.Clients {
-			client.SetAlarm("DNS", AlarmTriggered)
+	if b.down == nil {
+		b.down = make(map[MonitoredServer]int)
+	}
+	if b.arch == nil {
+		// Not in any architecture, only this server raises the DNS alarms
+		b.arch = &Architecture{mon: b.mon}
+	}
+	for _, client := range b.Clients {
+		down := noticeDown(client, b, t)
+		trigger, wasDown := b.down[client]
+		if down && !wasDown {
+			b.down[client] = b.arch.raiseAlarms([]MonitoredServer{client}, []string{"DNS"}, b.Cause())
+		} else if !down && wasDown {
+			// The alarm stays triggered while other DNS server or a fault holds it
+			delete(b.down, client)
+			b.arch.clearAlarms(trigger, []MonitoredServer{client}, []string{"DNS"})
 		}
 	}
+	b.checkAlarm("Proc", &b.ProcAlarm, t)
 
 	b.Server.CheckAlarms(t)
 }
 
-// Available returns true if the Frontend server is considered available, that is,
-// if the Frontend process is running and the database is available.
+// Available returns true if the DNS server is considered available, that is,
+// if the DNS process is running and the server is available.
 func (b *DNS) Available() bool {
-	return b.Server.Available() && b.ProcAlarm == AlarmEnabled
+	return b.Server.Available() && !b.failed("Proc", b.ProcAlarm)
+}
+
+// Cause returns the incident that made the DNS server unavailable
+func (b *DNS) Cause() string {
+	if !b.Server.Available() {
+		return b.Server.Cause()
+	}
+	return b.incident("Proc")
 }
 
 func (b *DNS) SetAlarm(alarm string, status AlarmStatus) {
@@ -63,3 +100,11 @@ func (b *DNS) SetAlarm(alarm string, status AlarmStatus) {
 		b.Server.SetAlarm(alarm, status)
 	}
 }
+
+// alarmStatus return the status of any alarm of the DNS server
+func (b *DNS) alarmStatus(alarm string) AlarmStatus {
+	if alarm == "Proc" {
+		return b.ProcAlarm
+	}
+	return b.Server.alarmStatus(alarm)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSDownAffectClients(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	dns := NewDNS("dns1", mon)
+	dns.AddClient(db1)
+	dns.AddClient(backend1)
+
+	time := 0.0
+	checkAll := func() {
+		dns.CheckAlarms(time)
+		db1.CheckAlarms(time)
+		backend1.CheckAlarms(time)
+		time++
+	}
+
+	// Stop the DNS process
+	dns.ProcAlarm = AlarmTriggered
+	dns.SetIncident("Proc", "dns1-down-0")
+	checkAll()
+	assert.Equal(t, []string{"0,dns1,Proc", "0,db1,DNS", "0,backend1,DBConnection", "0,backend1,DNS"}, mon.Alarms)
+	for _, e := range mon.Events {
+		assert.Equal(t, "dns1-down-0", e.Incident)
+	}
+
+	// The alarms of the clients are not triggered again while the DNS is down
+	checkAll()
+	assert.Len(t, mon.Events, 4)
+
+	// When the DNS is back, the DNS alarms of the clients are resolved
+	dns.ProcAlarm = AlarmEnabled
+	checkAll()
+	resolved := []string{}
+	for _, e := range mon.Events[4:] {
+		assert.Equal(t, ResolvedState, e.State)
+		assert.Equal(t, "dns1-down-0", e.Incident)
+		resolved = append(resolved, e.Server+","+e.Alarm)
+	}
+	assert.Equal(t, []string{"dns1,Proc", "db1,DNS", "backend1,DBConnection", "backend1,DNS"}, resolved)
+}
+
+// TestDNSSharedClient checks that the DNS alarm of a client with two DNS
+// servers is not resolved until both of them are available
+func TestDNSSharedClient(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	dns1 := a.NewDNS("dns1")
+	dns2 := a.NewDNS("dns2")
+	dns1.AddClient(srv1)
+	dns2.AddClient(srv1)
+
+	time := 0.0
+	checkAll := func() {
+		dns1.CheckAlarms(time)
+		dns2.CheckAlarms(time)
+		srv1.CheckAlarms(time)
+		time++
+	}
+
+	dns1.SetAlarm("Proc", AlarmTriggered)
+	dns1.SetIncident("Proc", "dns1-down-0")
+	checkAll()
+	dns2.SetAlarm("Proc", AlarmTriggered)
+	dns2.SetIncident("Proc", "dns2-down-0")
+	checkAll()
+	assert.Equal(t, []string{"0,dns1,Proc", "0,srv1,DNS", "1,dns2,Proc"}, mon.Alarms)
+
+	// dns1 is back, but the client still can't use dns2
+	dns1.SetAlarm("Proc", AlarmEnabled)
+	checkAll()
+	assert.Equal(t, AlarmACK, srv1.DNSAlarm)
+
+	dns2.SetAlarm("Proc", AlarmEnabled)
+	checkAll()
+	last := mon.Events[len(mon.Events)-1]
+	assert.Equal(t, "srv1", last.Server)
+	assert.Equal(t, ResolvedState, last.State)
+	assert.Equal(t, 3.0, last.Time)
+}
+
+// TestDNSFaultClient checks that a DNS server back doesn't resolve the DNS
+// alarm of a client still held by a fault
+func TestDNSFaultClient(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	dns1 := a.NewDNS("dns1")
+	dns1.AddClient(srv1)
+
+	time := 0.0
+	checkAll := func() {
+		dns1.CheckAlarms(time)
+		srv1.CheckAlarms(time)
+		time++
+	}
+
+	a.raiseAlarms([]MonitoredServer{srv1}, []string{"DNS"}, "srv1-dns-0")
+	checkAll()
+	dns1.SetAlarm("Proc", AlarmTriggered)
+	dns1.SetIncident("Proc", "dns1-down-0")
+	checkAll()
+	dns1.SetAlarm("Proc", AlarmEnabled)
+	checkAll()
+
+	assert.Equal(t, []string{
+		"0,srv1,DNS,problem,critical",
+		"1,dns1,Proc,problem,critical",
+		"1,srv1,DNS,updated,critical",
+		"2,dns1,Proc,resolved,critical",
+		"2,srv1,DNS,updated,critical",
+	}, eventLines(mon))
+	assert.Equal(t, "srv1-dns-0", mon.Events[4].Incident)
+	assert.Equal(t, AlarmACK, srv1.DNSAlarm)
+}
+
+func TestDNSSimulated(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := &Architecture{mon: mon}
+
+	srv1 := a.NewServer("srv1")
+	dns := a.NewDNS("dns1")
+	dns.AddClient(srv1)
+
+	a.AddFault(&Fault{
+		Name:     "dns1-down",
+		Target:   dns.Name,
+		Alarm:    "Proc",
+		Start:    Constant(10),
+		Duration: Constant(5),
+	})
+	a.Start(30)
+
+	alarms := []string{}
+	for _, e := range mon.Events {
+		alarms = append(alarms, e.Server+","+e.Alarm+","+string(e.State))
+	}
+	assert.ElementsMatch(t, []string{
+		"dns1,Proc,problem", "srv1,DNS,problem",
+		"dns1,Proc,resolved", "srv1,DNS,resolved",
+	}, alarms)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/fschuetz04/simgo"
+)
+
+// Exhaustion is a fault model where a resource of the targets is consumed
+// gradually, like a disk filling or a memory leak. The alarms of the fault are
+// triggered as warning when the resource reaches the Warning level, escalate
+// to critical at the Critical level and, when the resource is exhausted, the
+// Then alarms are triggered. After the Duration of the fault everything is
+// cleared.
+//
+//	start       warning   critical  exhausted          cleared
+//	|-----------|---------|---------|------------------|
+//	|<------------ fill ----------->|<-- duration ---->|
+type Exhaustion struct {
+	// Fill is the time since the start of the repetition until the resource is exhausted
+	Fill *Distribution `yaml:"fill"`
+	// Warning and Critical are the fraction of the resource used when the
+	// alarms are triggered as warning and when they escalate to critical.
+	// By default 0.8 and 0.95.
+	Warning  float64 `yaml:"warning"`
+	Critical float64 `yaml:"critical"`
+	// Then are the alarms of the same servers triggered when the resource is
+	// exhausted, like DBEngine when the disk is full or Proc after an OOM
+	Then []string `yaml:"then"`
+	// Free clear the alarms of the fault when the resource is exhausted, like
+	// the memory freed when the process is killed by the OOM killer
+	Free bool `yaml:"free"`
+}
+
+// levels return the warning and critical levels, with their default values
+func (e *Exhaustion) levels() (float64, float64) {
+	warning, critical := e.Warning, e.Critical
+	if warning == 0 {
+		warning = 0.8
+	}
+	if critical == 0 {
+		critical = 0.95
+	}
+	return warning, critical
+}
+
+func (e *Exhaustion) validate() error {
+	if e.Fill == nil {
+		return fmt.Errorf("exhaustion without fill time")
+	}
+	warning, critical := e.levels()
+	if warning < 0 || warning > critical || critical > 1 {
+		return fmt.Errorf("exhaustion levels should be 0 <= warning (%v) <= critical (%v) <= 1", warning, critical)
+	}
+	return nil
+}
+
+// exhaust return the process of one repetition of a fault with exhaustion.
+// duration is the time the resource stays exhausted, negative if it is never
+// cleared.
+func (f *Fault) exhaust(a *Architecture, name string, servers []MonitoredServer, alarms []string, fill, duration float64) func(simgo.Process) {
+	e := f.Exhaustion
+	warning, critical := e.levels()
+
+	return func(proc simgo.Process) {
+		// Wait until the times since the start, to not accumulate rounding errors
+		start := proc.Now()
+		until := func(t float64) {
+			proc.Wait(proc.Timeout(math.Max(start+t-proc.Now(), 0)))
+		}
+
+		until(fill * warning)
+		incident := ""
+		if !f.Noise {
+			incident = a.StartIncident(name, proc.Now(), servers, alarms)
+		}
+		trigger := a.raiseAlarms(servers, alarms, incident)
+		a.setSeverity(trigger, servers, alarms, SeverityWarning)
+
+		until(fill * critical)
+		a.setSeverity(trigger, servers, alarms, SeverityCritical)
+
+		until(fill)
+		then := a.raiseAlarms(servers, e.Then, incident)
+		if e.Free {
+			a.clearAlarms(trigger, servers, alarms)
+		}
+
+		if duration < 0 {
+			return
+		}
+		until(fill + duration)
+		a.clearAlarms(trigger, servers, alarms)
+		a.clearAlarms(then, servers, e.Then)
+		if !f.Noise {
+			a.EndIncident(incident, proc.Now())
+		}
+	}
+}
+
+// DiskFillFault return a fault that fills the disk of the target in the fill
+// time, staying full for duration. The then alarms are triggered when the
+// disk is full, like DBEngine in a database.
+func DiskFillFault(name, target string, fill, duration *Distribution, then ...string) *Fault {
+	return &Fault{
+		Name:       name,
+		Target:     target,
+		Alarm:      "Disk",
+		Duration:   duration,
+		Exhaustion: &Exhaustion{Fill: fill, Then: then},
+	}
+}
+
+// MemoryLeakFault return a fault where the memory of the target grows until
+// the process is killed by the OOM killer, raising the Proc alarm until it is
+// restarted after the restart time
+func MemoryLeakFault(name, target string, fill, restart *Distribution) *Fault {
+	return &Fault{
+		Name:       name,
+		Target:     target,
+		Alarm:      "Memory",
+		Duration:   restart,
+		Exhaustion: &Exhaustion{Fill: fill, Then: []string{"Proc"}, Free: true},
+	}
+}
+
+// CPUSaturationFault return a fault where the load of the target grows until
+// the CPU is saturated in the ramp time, staying saturated for duration
+func CPUSaturationFault(name, target string, ramp, duration *Distribution) *Fault {
+	return &Fault{
+		Name:       name,
+		Target:     target,
+		Alarm:      "CPU",
+		Duration:   duration,
+		Exhaustion: &Exhaustion{Fill: ramp},
+	}
+}
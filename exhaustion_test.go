@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fschuetz04/simgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// simulateFaults run the faults checking the alarms of the servers each minute,
+// at the middle of the minute, and return the events as "time,server,alarm,state,severity"
+func simulateFaults(t *testing.T, a *Architecture, mon *fakeMonSys, faults []*Fault, until float64, servers ...MonitoredServer) []string {
+	sim := simgo.Simulation{}
+	for _, f := range faults {
+		monkey, err := f.Monkey(a)
+		assert.NoError(t, err)
+		sim.Process(monkey)
+	}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			for _, s := range servers {
+				s.CheckAlarms(proc.Now())
+			}
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(until)
+	return eventLines(mon)
+}
+
+// TestDiskFill checks that the disk alarm escalates while the disk fills, and
+// the database is down only when it is full
+func TestDiskFill(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+	a.AddDB(db1)
+	a.AddBackend(backend1)
+
+	f := DiskFillFault("db1-disk", "db1", Constant(100), Constant(20), "DBEngine")
+	events := simulateFaults(t, &a, mon, []*Fault{f}, 150, db1, backend1)
+
+	assert.Equal(t, []string{
+		"80.5,db1,Disk,problem,warning",
+		"95.5,db1,Disk,updated,critical",
+		"100.5,db1,DBEngine,problem,critical",
+		"100.5,backend1,DBConnection,problem,critical",
+		"120.5,db1,DBEngine,resolved,critical",
+		"120.5,db1,Disk,resolved,critical",
+		"120.5,backend1,DBConnection,resolved,critical",
+	}, events)
+
+	// The ground truth is the disk, the events of the database and the backend are caused by it
+	assert.Len(t, a.Incidents, 1)
+	assert.Equal(t, "Disk", a.Incidents[0].Alarm)
+	assert.Equal(t, 80.0, a.Incidents[0].Start)
+	assert.Equal(t, 120.0, a.Incidents[0].End)
+	assert.Equal(t, "db1-disk-0", mon.Events[3].Incident)
+}
+
+// TestMemoryLeak checks that the memory is freed when the process is killed,
+// and the process is down until it is restarted
+func TestMemoryLeak(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: &Database{}}
+	a.AddBackend(backend1)
+
+	f := MemoryLeakFault("backend1-leak", "backend1", Constant(100), Constant(10))
+	events := simulateFaults(t, &a, mon, []*Fault{f}, 150, backend1)
+
+	assert.Equal(t, []string{
+		"80.5,backend1,Memory,problem,warning",
+		"95.5,backend1,Memory,updated,critical",
+		"100.5,backend1,Proc,problem,critical",
+		"100.5,backend1,Memory,resolved,critical",
+		"110.5,backend1,Proc,resolved,critical",
+	}, events)
+}
+
+// TestExhaustionOverlap checks that other fault of the same alarm doesn't
+// clear the alarm while the resource is exhausted
+func TestExhaustionOverlap(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+
+	sat := CPUSaturationFault("sat", "srv1", Constant(25), Constant(85))
+	cpu := &Fault{Name: "cpu", Target: "srv1", Alarm: "CPU", Start: Constant(10), Duration: Constant(20)}
+	events := simulateFaults(t, &a, mon, []*Fault{sat, cpu}, 150, srv1)
+
+	assert.Equal(t, []string{
+		"10.5,srv1,CPU,problem,critical",
+		"20.5,srv1,CPU,updated,warning",
+		"24.5,srv1,CPU,updated,critical",
+		"110.5,srv1,CPU,resolved,critical",
+	}, events)
+	assert.Equal(t, "sat-0", mon.Events[1].Incident)
+	assert.Equal(t, "sat-0", mon.Events[3].Incident)
+}
+
+func TestExhaustionErrors(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+	a.AddServer(&Server{Name: "srv1"})
+
+	scenario := `faults:
+  - name: leak
+    target: srv1
+    alarm: Memory
+    exhaustion:
+      fill: 60
+      then: [Proc]
+  - name: levels
+    target: srv1
+    alarm: Disk
+    exhaustion:
+      fill: 60
+      warning: 0.9
+      critical: 0.5
+`
+	s, err := ParseScenario(strings.NewReader(scenario), "scenario.yaml")
+	assert.NoError(t, err)
+
+	_, err = s.Faults[0].Monkey(&a)
+	assert.EqualError(t, err, `fault "leak" references unknown alarm "Proc" in server "srv1"`)
+	_, err = s.Faults[1].Monkey(&a)
+	assert.EqualError(t, err, `fault "levels": exhaustion levels should be 0 <= warning (0.9) <= critical (0.5) <= 1`)
+}
@@ -8,6 +8,11 @@ type Frontend struct {
 	// BackendConnectionAlarm is True if the backend is not working
 	BackendConnectionAlarm AlarmStatus
 	Backend                *Backend
+	// LoadBalancer is used instead of Backend to connect to a pool of backends
+	LoadBalancer *LoadBalancer
+	// Transitive makes the frontend unavailable while the connection to the
+	// backend is lost, so the failure of the backend reaches its clients
+	Transitive bool
 }
 
 // NewFrontend create a new Frontend server, start it and return the pointer to it
@@ -21,6 +26,21 @@ func NewFrontend(name string, connectedBackend *Backend, mon MonitorSystem) *Fro
 	}
 }
 
+// NewPoolFrontend create a new Frontend server connected to the pool of a load balancer
+func NewPoolFrontend(name string, lb *LoadBalancer, mon MonitorSystem) *Frontend {
+	f := NewFrontend(name, nil, mon)
+	f.LoadBalancer = lb
+	return f
+}
+
+// upstream return the service the frontend is connected to: the backend or the load balancer
+func (b *Frontend) upstream() Service {
+	if b.LoadBalancer != nil {
+		return b.LoadBalancer
+	}
+	return b.Backend
+}
+
 func (b *Frontend) GetName() string {
 	return b.Name
 }
@@ -38,29 +58,41 @@ func (s *Frontend) GetType() string {
 // It check alarms specific to the Frontend, plus generic alarms for the server
 // and also generate an alarm if the backend is not available.
 func (b *Frontend) CheckAlarms(t float64) {
-	if b.ProcAlarm == AlarmTriggered {
-		b.ProcAlarm = AlarmACK
-		b.mon.handleAlarm(b.Name, "Proc", t)
-	}
+	b.checkAlarm("Proc", &b.ProcAlarm, t)
 
-	// Set the local backend connection alarm based on the state of the database.
-	// Generate a new alarm if we are moving from enabled to triggered.
-	if b.Backend.Available() {
+	// Set the local backend connection alarm based on the state of the backend.
+	// Generate a new alarm if we are moving from enabled to triggered, and
+	// resolve it when the backend is available again.
+	upstream := b.upstream()
+	if !b.noticeDown(upstream, t) {
 		b.BackendConnectionAlarm = AlarmEnabled
-	} else {
-		if b.BackendConnectionAlarm == AlarmEnabled {
-			b.BackendConnectionAlarm = AlarmACK
-			b.mon.handleAlarm(b.Name, "BackendConnection", t)
-		}
+	} else if b.BackendConnectionAlarm == AlarmEnabled {
+		b.BackendConnectionAlarm = AlarmTriggered
+		b.SetIncident("BackendConnection", upstream.Cause())
 	}
+	b.checkAlarm("BackendConnection", &b.BackendConnectionAlarm, t)
 
 	b.Server.CheckAlarms(t)
 }
 
 // Available returns true if the Frontend server is considered available, that is,
-// if the Frontend process is running and the database is available.
+// if the Frontend process is running and, if it is Transitive, the backend is available.
 func (b *Frontend) Available() bool {
-	return b.Server.Available() && b.ProcAlarm == AlarmEnabled
+	if b.Transitive && b.failed("BackendConnection", b.BackendConnectionAlarm) {
+		return false
+	}
+	return b.Server.Available() && !b.failed("Proc", b.ProcAlarm)
+}
+
+// Cause returns the incident that made the Frontend server unavailable
+func (b *Frontend) Cause() string {
+	if !b.Server.Available() {
+		return b.Server.Cause()
+	}
+	if !b.failed("Proc", b.ProcAlarm) && b.Transitive && b.failed("BackendConnection", b.BackendConnectionAlarm) {
+		return b.incident("BackendConnection")
+	}
+	return b.incident("Proc")
 }
 
 func (b *Frontend) SetAlarm(alarm string, status AlarmStatus) {
@@ -73,3 +105,14 @@ func (b *Frontend) SetAlarm(alarm string, status AlarmStatus) {
 		b.Server.SetAlarm(alarm, status)
 	}
 }
+
+// alarmStatus return the status of any alarm of the frontend
+func (b *Frontend) alarmStatus(alarm string) AlarmStatus {
+	switch alarm {
+	case "Proc":
+		return b.ProcAlarm
+	case "BackendConnection":
+		return b.BackendConnectionAlarm
+	}
+	return b.Server.alarmStatus(alarm)
+}
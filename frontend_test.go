@@ -45,3 +45,36 @@ func TestBackendDownAffectFrontendAlarm(t *testing.T) {
 
 	assert.Equal(t, mon.Alarms, []string{"0,backend1,Ping", "0,frontend1,BackendConnection"})
 }
+
+func TestDBDownAffectTransitiveFrontendAlarm(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1, Transitive: true}
+	frontend1 := &Frontend{Server: Server{Name: "frontend1", mon: mon}, Backend: backend1}
+
+	time := 0.0
+
+	// Set the db down
+	db1.PingAlarm = AlarmTriggered
+	db1.SetIncident("Ping", "db1-down-0")
+
+	// Check alarms
+	db1.CheckAlarms(time)
+	backend1.CheckAlarms(time)
+	frontend1.CheckAlarms(time)
+
+	// The backend is not available while it could not connect to the database
+	assert.Equal(t, []string{"0,db1,Ping", "0,backend1,DBConnection", "0,frontend1,BackendConnection"}, mon.Alarms)
+	assert.Equal(t, "db1-down-0", mon.Events[2].Incident)
+
+	// When the db is back, the backend is available again
+	db1.PingAlarm = AlarmEnabled
+	time++
+	db1.CheckAlarms(time)
+	backend1.CheckAlarms(time)
+	frontend1.CheckAlarms(time)
+	assert.True(t, backend1.Available())
+	assert.Equal(t, ResolvedState, mon.Events[len(mon.Events)-1].State)
+	assert.Equal(t, "frontend1", mon.Events[len(mon.Events)-1].Server)
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/yaricom/goGraphML/graphml"
+)
+
+// graphNode is a node of the graph of the architecture, independent of the
+// output format
+type graphNode struct {
+	// key identify the node when creating the edges
+	key   string
+	id    string
+	name  string
+	label string
+	typ   string
+	// severity of the alarm nodes when they are triggered, empty for the servers
+	severity string
+
+	// start and end of the time the node exists, in minutes. end is negative
+	// if the node exists until the end of the simulation.
+	start float64
+	end   float64
+}
+
+// graphEdge is a link between two nodes of the graph, identified by their keys
+type graphEdge struct {
+	source string
+	target string
+	typ    EdgeType
+	weight float64
+	// desc is the name of the edge
+	desc string
+
+	// start and end of the time the edge exists, like in graphNode
+	start float64
+	end   float64
+}
+
+func (e graphEdge) key() string {
+	return e.source + "\x00" + e.target
+}
+
+// GraphOptions configure how the graph of the architecture is exported
+type GraphOptions struct {
+	// Directed export the edges following the direction of the dependencies:
+	// frontend → backend → database, client → DNS, server → alarm.
+	// Undirected by default.
+	Directed bool
+	// Weights of the edges by type. The types not present have weight 1.
+	Weights map[EdgeType]float64
+	// At export the topology as it was at that time of the simulation (in
+	// minutes), for architectures that change during the simulation.
+	// If nil the topology at the end of the simulation is exported.
+	At *float64
+	// Intervals export every node and edge that existed during the
+	// simulation, with its "start" and "end" times as attributes
+	Intervals bool
+}
+
+// weight return the weight of the edges of that type
+func (o GraphOptions) weight(typ EdgeType) float64 {
+	if w, ok := o.Weights[typ]; ok {
+		return w
+	}
+	return 1
+}
+
+// architectureGraph is the graph of the architecture used by all the exporters
+type architectureGraph struct {
+	options GraphOptions
+	nodes   []graphNode
+	edges   []graphEdge
+	// intervals is true if the start and end of nodes and edges should be exported
+	intervals bool
+
+	// nodeSet avoid adding edges to nodes not in the graph
+	nodeSet map[string]bool
+	// edgeSet avoid adding twice the same edge
+	edgeSet map[string]bool
+}
+
+func (g *architectureGraph) addNode(node graphNode) {
+	g.nodeSet[node.key] = true
+	node.end = -1
+	g.nodes = append(g.nodes, node)
+}
+
+// addEdge link two nodes, named desc, if they are not already linked.
+// Source is the node that depends on target.
+func (g *architectureGraph) addEdge(source, target string, typ EdgeType, desc string) {
+	// Links to servers removed from the architecture
+	if !g.nodeSet[source] || !g.nodeSet[target] {
+		return
+	}
+	// In undirected graphs A-B is the same edge than B-A
+	if g.edgeSet[source+"\x00"+target] || (!g.options.Directed && g.edgeSet[target+"\x00"+source]) {
+		return
+	}
+	g.edgeSet[source+"\x00"+target] = true
+
+	g.edges = append(g.edges, graphEdge{
+		source: source,
+		target: target,
+		typ:    typ,
+		weight: g.options.weight(typ),
+		desc:   desc,
+		end:    -1,
+	})
+}
+
+// integerWeights return true if all the weights are integers
+func (g *architectureGraph) integerWeights() bool {
+	for _, edge := range g.edges {
+		if edge.weight != math.Trunc(edge.weight) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateEventIDs assign the event ID of every alarm of the architecture in
+// the same order as the graph, so the IDs are the same whether the graph is
+// exported before the simulation or not
+func (a *Architecture) generateEventIDs() {
+	for _, server := range a.GetAllServers() {
+		s, ok := server.(ArchitectureServer)
+		if !ok {
+			continue
+		}
+		for _, alarm := range s.GetAlarms() {
+			a.mon.generateEventID(s.GetName(), s.AlarmName(alarm))
+		}
+	}
+}
+
+// graph build the graph of the architecture: a node for each server and each
+// of its alarms, and edges between the servers and their alarms and between
+// connected servers.
+func (a *Architecture) graph() *architectureGraph {
+	g := &architectureGraph{
+		options: a.GraphOptions,
+		nodeSet: make(map[string]bool),
+		edgeSet: make(map[string]bool),
+	}
+
+	createServer := func(server ArchitectureServer) {
+		g.addNode(graphNode{
+			key:   server.GetName(),
+			id:    server.GetName(),
+			name:  server.GetName(),
+			label: server.GetName(),
+			typ:   server.GetType(),
+		})
+
+		for _, alarm := range server.GetAlarms() {
+			alarmName := server.AlarmName(alarm)
+			name := fmt.Sprintf("%s-%s", server.GetName(), alarmName)
+			g.addNode(graphNode{
+				key:      name,
+				id:       fmt.Sprintf("%d", a.mon.generateEventID(server.GetName(), alarmName)),
+				name:     name,
+				label:    alarmName,
+				typ:      string(AlarmNode),
+				severity: server.BaseSeverity(alarm).String(),
+			})
+			g.addEdge(server.GetName(), name, TriggerEdge, fmt.Sprintf("%s-%s", server.GetName(), alarmName))
+		}
+	}
+
+	// Add the Servers
+	for _, server := range a.Servers {
+		createServer(server)
+	}
+
+	for _, server := range a.DBs {
+		createServer(server)
+	}
+
+	for _, backend := range a.Backends {
+		createServer(backend)
+	}
+
+	for _, frontend := range a.Frontends {
+		createServer(frontend)
+	}
+
+	for _, lb := range a.LoadBalancers {
+		createServer(lb)
+	}
+
+	for _, dns := range a.DNSs {
+		createServer(dns)
+	}
+
+	for _, component := range a.Components {
+		createServer(component)
+	}
+
+	for _, cluster := range a.QuorumClusters {
+		createServer(cluster)
+	}
+
+	for _, node := range a.KubeNodes {
+		createServer(node)
+	}
+
+	for _, pod := range a.Pods {
+		createServer(pod)
+	}
+
+	for _, deployment := range a.Deployments {
+		createServer(deployment)
+	}
+
+	for _, hypervisor := range a.Hypervisors {
+		createServer(hypervisor)
+	}
+
+	// Create links between servers
+	// Lo ejecutamos tras importar todos los servidores para asegurarnos de que
+	// ya se han añadido.
+
+	for _, backend := range a.Backends {
+		// Add edge between the backend and the database
+		g.addEdge(backend.Name, backend.DBEngine.Name, ConnectEdge, fmt.Sprintf("%s-%s", backend.Name, backend.DBEngine.Name))
+		// and its replicas and other dependencies
+		for _, replica := range backend.Replicas {
+			g.addEdge(backend.Name, replica.Name, ConnectEdge, fmt.Sprintf("%s-%s", backend.Name, replica.Name))
+		}
+		for _, d := range backend.Dependencies {
+			for _, dependency := range append([]Service{d.Service}, d.Replicas...) {
+				g.addEdge(backend.Name, dependency.GetName(), ConnectEdge, fmt.Sprintf("%s-%s", backend.Name, dependency.GetName()))
+			}
+		}
+	}
+
+	for _, frontend := range a.Frontends {
+		// Add edge between the frontend and the backend (or the load balancer of the backends)
+		upstream := frontend.upstream().GetName()
+		g.addEdge(frontend.Name, upstream, ConnectEdge, fmt.Sprintf("%s-%s", frontend.Name, upstream))
+	}
+
+	for _, lb := range a.LoadBalancers {
+		// Add edges between the load balancer and its frontends
+		for _, frontend := range lb.Frontends {
+			g.addEdge(lb.Name, frontend.Name, ConnectEdge, fmt.Sprintf("%s-%s", lb.Name, frontend.Name))
+		}
+		// and the members of its pool
+		for _, member := range lb.Members {
+			g.addEdge(lb.Name, member.GetName(), ConnectEdge, fmt.Sprintf("%s-%s", lb.Name, member.GetName()))
+		}
+	}
+
+	for _, component := range a.Components {
+		// Add edges between the component and its dependencies
+		for _, dependency := range component.Dependencies {
+			g.addEdge(component.Name, dependency.GetName(), ConnectEdge, fmt.Sprintf("%s-%s", component.Name, dependency.GetName()))
+		}
+	}
+
+	// Creamos links entre servidores que pertenecen a un cluster. Si el grafo es
+	// dirigido, se crean en los dos sentidos.
+	for _, cluster := range a.Clusters {
+		for _, serverA := range cluster {
+			for _, serverB := range cluster {
+				// No crear links entre un servidor con sí mismo
+				if serverA.GetName() == serverB.GetName() {
+					continue
+				}
+				g.addEdge(serverA.GetName(), serverB.GetName(), ConnectEdge, fmt.Sprintf("%s-%s", serverA.GetName(), serverB.GetName()))
+			}
+		}
+	}
+
+	// Each cluster with a node is linked to its members
+	for _, cluster := range a.QuorumClusters {
+		for _, member := range cluster.Members {
+			g.addEdge(cluster.Name, member.GetName(), MemberEdge, fmt.Sprintf("%s-%s", cluster.Name, member.GetName()))
+		}
+	}
+
+	// Each deployment is linked to its pods, and each pod to the node where it runs
+	for _, deployment := range a.Deployments {
+		for _, pod := range deployment.Pods {
+			g.addEdge(deployment.Name, pod.Name, MemberEdge, fmt.Sprintf("%s-%s", deployment.Name, pod.Name))
+		}
+	}
+	for _, pod := range a.Pods {
+		if pod.Node != nil {
+			g.addEdge(pod.Name, pod.Node.Name, ScheduledEdge, fmt.Sprintf("%s-%s", pod.Name, pod.Node.Name))
+		}
+	}
+
+	// Each guest is linked to the hypervisor where it runs
+	for _, hypervisor := range a.Hypervisors {
+		for _, guest := range hypervisor.Guests {
+			g.addEdge(guest.GetName(), hypervisor.Name, HostedEdge, fmt.Sprintf("%s-%s", guest.GetName(), hypervisor.Name))
+		}
+	}
+
+	// Creamos links entre los servidores que usan un DNS
+	for _, dns := range a.DNSs {
+		for _, server := range dns.Clients {
+			g.addEdge(server.GetName(), dns.Name, DNSConnectEdge, fmt.Sprintf("%s-%s", server.GetName(), dns.Name))
+		}
+	}
+
+	return g
+}
+
+// topologyHistory store when each node and edge of the graph existed, for
+// architectures that change during the simulation
+type topologyHistory struct {
+	nodes []*graphNode
+	edges []*graphEdge
+
+	// open are the nodes and edges that exist now, by key
+	openNodes map[string]*graphNode
+	openEdges map[string]*graphEdge
+}
+
+func newTopologyHistory() *topologyHistory {
+	return &topologyHistory{
+		openNodes: make(map[string]*graphNode),
+		openEdges: make(map[string]*graphEdge),
+	}
+}
+
+// record compare the graph with the nodes and edges that exist, starting at
+// time t the new ones and ending the ones that are not in the graph anymore
+func (h *topologyHistory) record(g *architectureGraph, t float64) {
+	seen := make(map[string]bool)
+	for _, n := range g.nodes {
+		seen[n.key] = true
+		if _, ok := h.openNodes[n.key]; !ok {
+			node := n
+			node.start = t
+			h.nodes = append(h.nodes, &node)
+			h.openNodes[n.key] = &node
+		}
+	}
+	for key, node := range h.openNodes {
+		if !seen[key] {
+			node.end = t
+			delete(h.openNodes, key)
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, e := range g.edges {
+		seen[e.key()] = true
+		if _, ok := h.openEdges[e.key()]; !ok {
+			edge := e
+			edge.start = t
+			h.edges = append(h.edges, &edge)
+			h.openEdges[e.key()] = &edge
+		}
+	}
+	for key, edge := range h.openEdges {
+		if !seen[key] {
+			edge.end = t
+			delete(h.openEdges, key)
+		}
+	}
+}
+
+// graph return the graph selected by the options: the topology at time At,
+// every node and edge if Intervals, or the current topology
+func (h *topologyHistory) graph(options GraphOptions) *architectureGraph {
+	valid := func(start, end float64) bool {
+		if options.At != nil {
+			return start <= *options.At && (end < 0 || *options.At < end)
+		}
+		return options.Intervals || end < 0
+	}
+
+	g := &architectureGraph{options: options, intervals: options.Intervals}
+	for _, node := range h.nodes {
+		if valid(node.start, node.end) {
+			g.nodes = append(g.nodes, *node)
+		}
+	}
+	for _, edge := range h.edges {
+		if valid(edge.start, edge.end) {
+			g.edges = append(g.edges, *edge)
+		}
+	}
+	return g
+}
+
+// exportGraph return the graph to export with the GraphOptions of the architecture
+func (a *Architecture) exportGraph() *architectureGraph {
+	h := a.history
+	if h == nil {
+		if a.GraphOptions.At == nil && !a.GraphOptions.Intervals {
+			return a.graph()
+		}
+		// The topology has not changed, everything exists from the start
+		h = newTopologyHistory()
+		h.record(a.graph(), 0)
+	}
+	return h.graph(a.GraphOptions)
+}
+
+// nodeAttributes return the attributes of the node exported in every format
+func (g *architectureGraph) nodeAttributes(node graphNode) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"id":    node.id,
+		"name":  node.name,
+		"label": node.label,
+		"type":  node.typ,
+	}
+	if node.severity != "" {
+		attributes["severity"] = node.severity
+	}
+	return g.intervalAttributes(attributes, node.start, node.end)
+}
+
+// intervalAttributes add the start and end of a node or edge, in seconds like
+// the events, if the graph is exported with intervals
+func (g *architectureGraph) intervalAttributes(attributes map[string]interface{}, start, end float64) map[string]interface{} {
+	if g.intervals {
+		attributes["start"] = eventSeconds(start)
+		if end >= 0 {
+			end = eventSeconds(end)
+		}
+		attributes["end"] = end
+	}
+	return attributes
+}
+
+// GraphML return the graph of the architecture in GraphML format
+func (a *Architecture) GraphML() *graphml.GraphML {
+	direction := graphml.EdgeDirectionUndirected
+	if a.GraphOptions.Directed {
+		direction = graphml.EdgeDirectionDirected
+	}
+
+	gm := graphml.NewGraphML("") // Si ponemos un description aquí, Cytoscape no es capaz de abrir el fichero
+	g, err := gm.AddGraph("ghostpipe-graph", direction, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// Mapa para poder obtener el nodo a partir de su clave. Para crear los links
+	// entre servidores.
+	nodeMap := make(map[string]*graphml.Node)
+
+	ag := a.exportGraph()
+	for _, node := range ag.nodes {
+		n, err := g.AddNode(ag.nodeAttributes(node), node.key)
+		if err != nil {
+			panic(err)
+		}
+		nodeMap[node.key] = n
+	}
+
+	// The type of the weight key is taken from the first value, so all the
+	// weights have to be of the same type. Use int if it is possible.
+	integerWeights := ag.integerWeights()
+	for _, edge := range ag.edges {
+		var weight interface{} = edge.weight
+		if integerWeights {
+			weight = int(edge.weight)
+		}
+		_, err = g.AddEdge(nodeMap[edge.source], nodeMap[edge.target], ag.intervalAttributes(map[string]interface{}{
+			"type":   edge.typ,
+			"weight": weight,
+		}, edge.start, edge.end),
+			direction,
+			edge.desc,
+		)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return gm
+}
+
+// CytoscapeGraph is the JSON format (.cyjs) used by Cytoscape.js and Cytoscape desktop
+type CytoscapeGraph struct {
+	Data     map[string]interface{} `json:"data"`
+	Elements CytoscapeElements      `json:"elements"`
+}
+
+// CytoscapeElements are the nodes and edges of the graph
+type CytoscapeElements struct {
+	Nodes []CytoscapeElement `json:"nodes"`
+	Edges []CytoscapeElement `json:"edges"`
+}
+
+// CytoscapeElement is a node or an edge. All its attributes are in Data.
+type CytoscapeElement struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// CytoscapeJSON return the graph of the architecture in Cytoscape JSON format,
+// with the same nodes, edges and attributes than GraphML
+func (a *Architecture) CytoscapeJSON() *CytoscapeGraph {
+	cy := &CytoscapeGraph{
+		Data: map[string]interface{}{
+			"name":     "ghostpipe-graph",
+			"directed": a.GraphOptions.Directed,
+		},
+		Elements: CytoscapeElements{
+			Nodes: []CytoscapeElement{},
+			Edges: []CytoscapeElement{},
+		},
+	}
+
+	// Cytoscape references the nodes by their id in the edges
+	ids := make(map[string]string)
+
+	ag := a.exportGraph()
+	for _, node := range ag.nodes {
+		ids[node.key] = node.id
+		cy.Elements.Nodes = append(cy.Elements.Nodes, CytoscapeElement{Data: ag.nodeAttributes(node)})
+	}
+
+	for i, edge := range ag.edges {
+		cy.Elements.Edges = append(cy.Elements.Edges, CytoscapeElement{Data: ag.intervalAttributes(map[string]interface{}{
+			"id":          fmt.Sprintf("e%d", i),
+			"source":      ids[edge.source],
+			"target":      ids[edge.target],
+			"name":        edge.desc,
+			"interaction": edge.typ,
+			"type":        edge.typ,
+			"weight":      edge.weight,
+		}, edge.start, edge.end)})
+	}
+
+	return cy
+}
+
+// Encode write the graph in JSON
+func (cy *CytoscapeGraph) Encode(w io.Writer, withIndent bool) error {
+	enc := json.NewEncoder(w)
+	if withIndent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(cy)
+}
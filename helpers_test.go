@@ -8,6 +8,7 @@ import (
 type fakeMonSys struct {
 	sync.RWMutex
 	Alarms []string
+	Events []Event
 }
 
 func (m *fakeMonSys) generateEventID(server string, alarm string) int {
@@ -22,6 +23,8 @@ func (m *fakeMonSys) generateEventID(server string, alarm string) int {
 		eventid = 300
 	case "frontend1":
 		eventid = 400
+	case "dns1":
+		eventid = 500
 	default:
 		panic("Unknown server, must be initiliazed")
 	}
@@ -43,6 +46,10 @@ func (m *fakeMonSys) generateEventID(server string, alarm string) int {
 		eventid += 7
 	case "BackendConnection":
 		eventid += 8
+	case "DNS":
+		eventid += 9
+	case "SQLPoolExhausted":
+		eventid += 10
 	default:
 		panic("Unknown alarm, must be initiliazed")
 	}
@@ -50,9 +57,35 @@ func (m *fakeMonSys) generateEventID(server string, alarm string) int {
 	return eventid
 }
 
-func (m *fakeMonSys) handleAlarm(server string, alarm string, time float64) {
+func (m *fakeMonSys) handleAlarm(event Event) {
 	m.Lock()
 	defer m.Unlock()
-	// Get time in unix epoch format
-	m.Alarms = append(m.Alarms, fmt.Sprintf("%.0f,%s,%s", time, server, alarm))
+	// Alarms only store the problems, Events store every event
+	if event.State == ProblemState {
+		m.Alarms = append(m.Alarms, fmt.Sprintf("%.0f,%s,%s", event.Time, event.Server, event.Alarm))
+	}
+	m.Events = append(m.Events, event)
+}
+
+// eventLines return the events as "time,server,alarm,state,severity"
+func eventLines(mon *fakeMonSys) []string {
+	events := []string{}
+	for _, e := range mon.Events {
+		events = append(events, fmt.Sprintf("%v,%s,%s,%s,%s", e.Time, e.Server, e.Alarm, e.State, e.Severity))
+	}
+	return events
+}
+
+// edgeLines return the edges of the graph of the architecture with any of the
+// types as "type:source-target"
+func edgeLines(a *Architecture, types ...EdgeType) []string {
+	edges := []string{}
+	for _, e := range a.CytoscapeJSON().Elements.Edges {
+		for _, typ := range types {
+			if e.Data["type"] == typ {
+				edges = append(edges, fmt.Sprintf("%s:%s-%s", typ, e.Data["source"], e.Data["target"]))
+			}
+		}
+	}
+	return edges
 }
@@ -0,0 +1,297 @@
+package main
+
+import "fmt"
+
+// DefaultMigrationDuration is the time a live migration of a guest takes
+const DefaultMigrationDuration = 2
+
+// Hypervisor is a physical host where servers of any type run as virtual
+// machines (its guests). When the hypervisor is down all its guests are
+// down too: Ping, and Proc if they have it, are triggered in every guest
+// with the incident of the hypervisor.
+//
+// The guests could be live migrated to other hypervisor (like vMotion),
+// raising the informational alarm "vMotion:<guest>" in the destination while
+// the migration lasts. The hypervisors of an architecture migrate one of
+// their guests to the hypervisor with less guests when their CPU or Memory
+// alarms are triggered.
+type Hypervisor struct {
+	Server
+	// Guests are the servers running on the hypervisor
+	Guests []MonitoredServer
+	// MigrationDuration is the time the migrations to this hypervisor take.
+	// DefaultMigrationDuration if 0.
+	MigrationDuration float64
+
+	// status of the vMotion alarms of the guests
+	status map[string]AlarmStatus
+	// migrating store, for each guest being migrated to this hypervisor,
+	// when the migration ends
+	migrating map[MonitoredServer]float64
+	// down is true while the guests are down because of the hypervisor, and
+	// outage the trigger of the alarms raised in each guest meanwhile
+	down   bool
+	outage map[MonitoredServer]int
+	// overloaded is true while CPU or Memory are triggered
+	overloaded bool
+	// arch is the architecture of the hypervisor, to find other hypervisors
+	// for the migrations, record the changes of the topology and raise the
+	// alarms of the guests along with the faults
+	arch *Architecture
+	// leaving are the vMotion alarms of the guests taken out of the
+	// hypervisor, resolved in the next check if they were triggered
+	leaving []string
+}
+
+// MigrationAlarm return the name of the alarm of the migration of the guest
+func MigrationAlarm(guest string) string {
+	return "vMotion:" + guest
+}
+
+// NewHypervisor create a new hypervisor with the guests running on it
+func NewHypervisor(name string, mon MonitorSystem, guests ...MonitoredServer) *Hypervisor {
+	h := &Hypervisor{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+	}
+	for _, guest := range guests {
+		h.AddGuest(guest)
+	}
+	return h
+}
+
+// AddGuest run the server on the hypervisor
+func (h *Hypervisor) AddGuest(guest MonitoredServer) {
+	h.Guests = append(h.Guests, guest)
+	h.SetSeverity(MigrationAlarm(guest.GetName()), SeverityInfo)
+}
+
+// RemoveGuest take the server out of the hypervisor
+func (h *Hypervisor) RemoveGuest(guest MonitoredServer) {
+	for i, g := range h.Guests {
+		if g == guest {
+			h.Guests = append(h.Guests[:i], h.Guests[i+1:]...)
+			break
+		}
+	}
+	delete(h.status, MigrationAlarm(guest.GetName()))
+	delete(h.migrating, guest)
+	h.leaving = append(h.leaving, MigrationAlarm(guest.GetName()))
+}
+
+func (h *Hypervisor) GetName() string {
+	return h.Name
+}
+
+// GetAlarms return the alarms of the server and the vMotion alarm of each guest
+func (h *Hypervisor) GetAlarms() []string {
+	alarms := h.Server.GetAlarms()
+	for _, guest := range h.Guests {
+		alarms = append(alarms, MigrationAlarm(guest.GetName()))
+	}
+	return alarms
+}
+
+func (h *Hypervisor) GetType() string {
+	return string(HypervisorNode)
+}
+
+func (h *Hypervisor) migrationDuration() float64 {
+	if h.MigrationDuration == 0 {
+		return DefaultMigrationDuration
+	}
+	return h.MigrationDuration
+}
+
+// guestAlarms return the alarms of the guest triggered when the hypervisor is down
+func guestAlarms(guest MonitoredServer) []string {
+	alarms := []string{}
+	for _, alarm := range []string{"Ping", "Proc"} {
+		if hasAlarm(guest, alarm) {
+			alarms = append(alarms, alarm)
+		}
+	}
+	return alarms
+}
+
+// CheckAlarms check the alarms of the hypervisor, bring its guests down or
+// up with it, start a migration if it is overloaded and end the migrations
+// to it.
+func (h *Hypervisor) CheckAlarms(t float64) {
+	h.Server.CheckAlarms(t)
+
+	if h.arch == nil {
+		// Not in any architecture, the guests only depend on the hypervisor
+		h.arch = &Architecture{mon: h.mon}
+	}
+
+	available := h.Available()
+	if !available && !h.down {
+		h.down = true
+		h.outage = make(map[MonitoredServer]int)
+		for _, guest := range h.Guests {
+			h.outage[guest] = h.arch.raiseAlarms([]MonitoredServer{guest}, guestAlarms(guest), h.Cause())
+		}
+	} else if available && h.down {
+		h.up()
+	}
+
+	overloaded := h.CPUAlarm != AlarmEnabled || h.MemoryAlarm != AlarmEnabled
+	if overloaded && !h.overloaded && available {
+		incident := h.incident("CPU")
+		if h.CPUAlarm == AlarmEnabled {
+			incident = h.incident("Memory")
+		}
+		h.rebalance(incident, t)
+	}
+	h.overloaded = overloaded
+
+	if h.status == nil {
+		h.status = make(map[string]AlarmStatus)
+	}
+	for _, guest := range h.Guests {
+		alarm := MigrationAlarm(guest.GetName())
+		if end, ok := h.migrating[guest]; ok && t >= end && h.status[alarm] == AlarmACK {
+			h.status[alarm] = AlarmEnabled
+			delete(h.migrating, guest)
+		}
+		status := h.status[alarm]
+		h.checkAlarm(alarm, &status, t)
+		h.status[alarm] = status
+	}
+
+	for _, alarm := range h.leaving {
+		status := AlarmEnabled
+		h.checkAlarm(alarm, &status, t)
+	}
+	h.leaving = nil
+}
+
+// up clear the alarms raised in the guests while the hypervisor was down
+func (h *Hypervisor) up() {
+	h.down = false
+	for guest, trigger := range h.outage {
+		h.arch.clearAlarms(trigger, []MonitoredServer{guest}, guestAlarms(guest))
+	}
+	h.outage = nil
+}
+
+// rebalance migrate one guest to the available hypervisor of the
+// architecture with less guests, if it has less guests than this one
+func (h *Hypervisor) rebalance(incident string, t float64) {
+	if h.arch == nil {
+		return
+	}
+	var to *Hypervisor
+	for _, other := range h.arch.Hypervisors {
+		if other == h || other.Removed() || !other.Available() {
+			continue
+		}
+		if to == nil || len(other.Guests) < len(to.Guests) {
+			to = other
+		}
+	}
+	if to == nil || len(to.Guests)+1 >= len(h.Guests) {
+		return
+	}
+	for _, guest := range h.Guests {
+		if _, ok := h.migrating[guest]; !ok {
+			h.migrate(guest, to, incident, t)
+			return
+		}
+	}
+}
+
+// migrate move the guest to other hypervisor, raising the vMotion alarm in
+// the destination until the migration ends
+func (h *Hypervisor) migrate(guest MonitoredServer, to *Hypervisor, incident string, t float64) {
+	h.RemoveGuest(guest)
+	to.AddGuest(guest)
+
+	alarm := MigrationAlarm(guest.GetName())
+	if to.status == nil {
+		to.status = make(map[string]AlarmStatus)
+	}
+	if to.migrating == nil {
+		to.migrating = make(map[MonitoredServer]float64)
+	}
+	to.status[alarm] = AlarmTriggered
+	to.SetIncident(alarm, incident)
+	to.migrating[guest] = t + to.migrationDuration()
+
+	if h.arch != nil && h.arch.history != nil {
+		h.arch.history.record(h.arch.graph(), t)
+	}
+}
+
+func (h *Hypervisor) SetAlarm(alarm string, status AlarmStatus) {
+	for _, guest := range h.Guests {
+		if alarm == MigrationAlarm(guest.GetName()) {
+			if h.status == nil {
+				h.status = make(map[string]AlarmStatus)
+			}
+			h.status[alarm] = status
+			return
+		}
+	}
+	h.Server.SetAlarm(alarm, status)
+}
+
+// alarmStatus return the status of any alarm of the hypervisor
+func (h *Hypervisor) alarmStatus(alarm string) AlarmStatus {
+	for _, guest := range h.Guests {
+		if alarm == MigrationAlarm(guest.GetName()) {
+			return h.status[alarm]
+		}
+	}
+	return h.Server.alarmStatus(alarm)
+}
+
+// Host return the hypervisor where the server runs, or nil if it is not a guest
+func (a *Architecture) Host(guest MonitoredServer) *Hypervisor {
+	for _, h := range a.Hypervisors {
+		for _, g := range h.Guests {
+			if g == guest {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// Migrate start a live migration of the guest to the hypervisor. It could be
+// used in the Changes of the architecture, like a planned maintenance.
+func (a *Architecture) Migrate(guest, hypervisor string) error {
+	server := a.GetServer(guest)
+	if server == nil {
+		return fmt.Errorf("unknown guest %q", guest)
+	}
+	from := a.Host(server)
+	if from == nil {
+		return fmt.Errorf("%q does not run on any hypervisor", guest)
+	}
+	to, ok := a.GetServer(hypervisor).(*Hypervisor)
+	if !ok {
+		return fmt.Errorf("unknown hypervisor %q", hypervisor)
+	}
+	if from == to {
+		return fmt.Errorf("%q already runs on %q", guest, hypervisor)
+	}
+	if to.down {
+		return fmt.Errorf("hypervisor %q is down", hypervisor)
+	}
+	if from.down {
+		return fmt.Errorf("hypervisor %q of %q is down", from.Name, guest)
+	}
+	if _, ok := from.migrating[server]; ok {
+		return fmt.Errorf("%q is being migrated to %q", guest, from.Name)
+	}
+	t := 0.0
+	if a.sim != nil {
+		t = a.sim.Now()
+	}
+	from.migrate(server, to, "", t)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/fschuetz04/simgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHypervisorDown checks that the guests are down while their hypervisor
+// is down, with the incident of the hypervisor
+func TestHypervisorDown(t *testing.T) {
+	mon := &fakeMonSys{}
+	srv1 := NewServer("srv1", mon)
+	dns1 := NewDNS("dns1", mon)
+	esx0 := NewHypervisor("esx0", mon, srv1, dns1)
+
+	esx0.SetAlarm("Ping", AlarmTriggered)
+	esx0.SetIncident("Ping", "esx0-down-0")
+	for time := 0.0; time < 3; time++ {
+		if time == 2 {
+			esx0.SetAlarm("Ping", AlarmEnabled)
+		}
+		esx0.CheckAlarms(time)
+		srv1.CheckAlarms(time)
+		dns1.CheckAlarms(time)
+	}
+
+	assert.Equal(t, []string{
+		"0,esx0,Ping,problem,critical",
+		"0,srv1,Ping,problem,critical",
+		"0,dns1,Proc,problem,critical",
+		"0,dns1,Ping,problem,critical",
+		"2,esx0,Ping,resolved,critical",
+		"2,srv1,Ping,resolved,critical",
+		"2,dns1,Proc,resolved,critical",
+		"2,dns1,Ping,resolved,critical",
+	}, eventLines(mon))
+	for _, e := range mon.Events {
+		assert.Equal(t, "esx0-down-0", e.Incident)
+	}
+}
+
+// TestHypervisorDownNoise checks that a guest alarm raised before its
+// hypervisor is down stays triggered, with the incident of the hypervisor,
+// until the hypervisor recovers
+func TestHypervisorDownNoise(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	esx0 := a.NewHypervisor("esx0", srv1)
+
+	a.AddFault(&Fault{Name: "noise", Target: "srv1", Alarm: "Ping", Duration: Constant(5), Noise: true})
+	a.AddFault(&Fault{Name: "hostdown", Target: "esx0", Alarm: "Ping", Start: Constant(2), Duration: Constant(30)})
+	sim := simgo.Simulation{}
+	for _, monkey := range a.Monkeys {
+		sim.Process(monkey)
+	}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			esx0.CheckAlarms(proc.Now())
+			srv1.CheckAlarms(proc.Now())
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(40)
+
+	assert.Equal(t, []string{
+		"0.5,srv1,Ping,problem,critical",
+		"2.5,esx0,Ping,problem,critical",
+		"2.5,srv1,Ping,updated,critical",
+		"32.5,esx0,Ping,resolved,critical",
+		"32.5,srv1,Ping,resolved,critical",
+	}, eventLines(mon))
+	assert.Equal(t, "hostdown-0", mon.Events[2].Incident)
+}
+
+// TestHypervisorMigration checks that an overloaded hypervisor migrates one
+// of its guests to the hypervisor with less guests
+func TestHypervisorMigration(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	srv2 := a.NewServer("srv2")
+	esx0 := a.NewHypervisor("esx0", srv1, srv2)
+	esx1 := a.NewHypervisor("esx1")
+
+	esx0.SetAlarm("CPU", AlarmTriggered)
+	esx0.SetIncident("CPU", "esx0-cpu-0")
+	for time := 0.0; time < 4; time++ {
+		esx0.CheckAlarms(time)
+		esx1.CheckAlarms(time)
+	}
+
+	assert.Equal(t, []string{
+		"0,esx0,CPU,problem,critical",
+		"0,esx1,vMotion:srv1,problem,info",
+		"2,esx1,vMotion:srv1,resolved,info",
+	}, eventLines(mon))
+	assert.Equal(t, "esx0-cpu-0", mon.Events[1].Incident)
+	assert.Equal(t, esx1, a.Host(srv1))
+	assert.Equal(t, esx0, a.Host(srv2))
+	assert.Equal(t, []string{"CPU", "Memory", "Disk", "Ping", "DNS", "vMotion:srv2"}, esx0.GetAlarms())
+
+	// Only one migration while it is overloaded, and only if it balances the guests
+	esx0.SetAlarm("CPU", AlarmEnabled)
+	esx0.CheckAlarms(4)
+	esx0.SetAlarm("CPU", AlarmTriggered)
+	esx0.CheckAlarms(5)
+	assert.Equal(t, esx0, a.Host(srv2))
+}
+
+func TestArchitectureMigrate(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	a.NewServer("srv2")
+	esx0 := a.NewHypervisor("esx0", srv1)
+	esx1 := a.NewHypervisor("esx1")
+
+	assert.EqualError(t, a.Migrate("srv3", "esx1"), `unknown guest "srv3"`)
+	assert.EqualError(t, a.Migrate("srv2", "esx1"), `"srv2" does not run on any hypervisor`)
+	assert.EqualError(t, a.Migrate("srv1", "srv2"), `unknown hypervisor "srv2"`)
+	assert.EqualError(t, a.Migrate("srv1", "esx0"), `"srv1" already runs on "esx0"`)
+
+	assert.NoError(t, a.Migrate("srv1", "esx1"))
+	assert.Equal(t, esx1, a.Host(srv1))
+	assert.Empty(t, esx0.Guests)
+	assert.EqualError(t, a.Migrate("srv1", "esx0"), `"srv1" is being migrated to "esx1"`)
+
+	// The migration is resolved when the guest is removed
+	srv3 := a.NewServer("srv3")
+	esx1.AddGuest(srv3)
+	assert.NoError(t, a.Migrate("srv3", "esx0"))
+	esx0.CheckAlarms(0)
+	a.RemoveServer("srv3")
+	esx0.CheckAlarms(1)
+	assert.Equal(t, []string{"0,esx0,vMotion:srv3,problem,info", "1,esx0,vMotion:srv3,resolved,info"}, eventLines(mon))
+
+	// No migrations to a hypervisor down
+	esx0.PingAlarm = AlarmTriggered
+	esx0.CheckAlarms(2)
+	assert.EqualError(t, a.Migrate("srv1", "esx0"), `hypervisor "esx0" is down`)
+
+	// The guests stay without hypervisor when it is removed
+	a.RemoveServer("esx1")
+	assert.Nil(t, a.Host(srv1))
+}
+
+// TestRemoveHypervisorDown checks that the guests are up again when their
+// hypervisor is removed while it is down
+func TestRemoveHypervisorDown(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	esx0 := a.NewHypervisor("esx0", srv1)
+
+	esx0.PingAlarm = AlarmTriggered
+	esx0.CheckAlarms(0)
+	srv1.CheckAlarms(0)
+	a.RemoveServer("esx0")
+	srv1.CheckAlarms(1)
+	assert.Equal(t, []string{
+		"0,esx0,Ping,problem,critical",
+		"0,srv1,Ping,problem,critical",
+		"1,srv1,Ping,resolved,critical",
+	}, eventLines(mon))
+}
+
+func TestTopologyHypervisors(t *testing.T) {
+	a := Architecture{mon: &PrinterMonitorSystem{Rand: rand.New(rand.NewSource(1))}}
+
+	topology := `servers:
+  - name: web
+    count: 3
+databases:
+  - name: db1
+hypervisors:
+  - name: esx
+    count: 2
+    guests: [web0, web1, web2]
+    migration_duration: 5
+  - name: dbhost
+    guests: [db1]
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+
+	if assert.Len(t, a.Hypervisors, 3) {
+		assert.Equal(t, 5.0, a.Hypervisors[0].MigrationDuration)
+		assert.Len(t, a.Hypervisors[0].Guests, 2)
+		assert.Len(t, a.Hypervisors[1].Guests, 1)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"hosted:web0-esx0", "hosted:web1-esx1", "hosted:web2-esx0", "hosted:db1-dbhost",
+	}, edgeLines(&a, HostedEdge))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Incident is the ground truth of an injected fault: which alarm of which
+// server was sabotaged and when. All the events caused by the fault carry the
+// ID of the incident.
+type Incident struct {
+	ID string
+	// Fault is the name of the fault that generated the incident
+	Fault  string
+	Server string
+	Alarm  string
+	Start  float64
+	// End is the time the alarm was cleared. Negative if it was never cleared.
+	End float64
+}
+
+// StartIncident register a new incident for each server and alarm affected by
+// a repetition of a fault. All of them share the same ID, that is returned.
+func (a *Architecture) StartIncident(fault string, t float64, servers []MonitoredServer, alarms []string) string {
+	if a.incidentCount == nil {
+		a.incidentCount = make(map[string]int)
+	}
+	id := fmt.Sprintf("%s-%d", fault, a.incidentCount[fault])
+	a.incidentCount[fault]++
+
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			a.Incidents = append(a.Incidents, &Incident{
+				ID:     id,
+				Fault:  fault,
+				Server: server.GetName(),
+				Alarm:  server.AlarmName(alarm),
+				Start:  t,
+				End:    -1,
+			})
+		}
+	}
+
+	return id
+}
+
+// EndIncident set the end time of the incident
+func (a *Architecture) EndIncident(id string, t float64) {
+	for _, incident := range a.Incidents {
+		if incident.ID == id {
+			incident.End = t
+		}
+	}
+}
+
+// WriteIncidents save the incidents in CSV format.
+// Times are in seconds, like in the events file. End is empty if the
+// incident never finished.
+func (a *Architecture) WriteIncidents(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("incident,fault,server,alarm,start,end\n")
+	if err != nil {
+		return err
+	}
+
+	for _, i := range a.Incidents {
+		end := ""
+		if i.End >= 0 {
+			end = fmt.Sprintf("%.0f", i.End*60)
+		}
+		_, err = fmt.Fprintf(f, "%s,%s,%s,%s,%.0f,%s\n", i.ID, i.Fault, i.Server, i.Alarm, i.Start*60, end)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadIncidents read an incidents CSV file, as written by WriteIncidents.
+// Times are kept in seconds.
+func ReadIncidents(r io.Reader) ([]*Incident, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty incidents file")
+	}
+
+	c, err := csvColumns(records[0], "incident", "fault", "server", "alarm", "start", "end")
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := []*Incident{}
+	for line, record := range records[1:] {
+		start, err := strconv.ParseFloat(record[c["start"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start %q", line+2, record[c["start"]])
+		}
+		end := -1.0
+		if record[c["end"]] != "" {
+			if end, err = strconv.ParseFloat(record[c["end"]], 64); err != nil {
+				return nil, fmt.Errorf("line %d: invalid end %q", line+2, record[c["end"]])
+			}
+		}
+
+		incidents = append(incidents, &Incident{
+			ID:     record[c["incident"]],
+			Fault:  record[c["fault"]],
+			Server: record[c["server"]],
+			Alarm:  record[c["alarm"]],
+			Start:  start,
+			End:    end,
+		})
+	}
+	return incidents, nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import "fmt"
+
+// DefaultRescheduleDelay is the time since a node is down until its pods are
+// scheduled in other nodes, like the pod eviction timeout of Kubernetes
+const DefaultRescheduleDelay = 5
+
+// KubeNode is a node of a Kubernetes cluster, where the pods run.
+// It is not available while the kubelet is NotReady.
+type KubeNode struct {
+	Server
+	// NotReadyAlarm is True if the kubelet of the node is not ready
+	NotReadyAlarm AlarmStatus
+	// Pods scheduled in the node
+	Pods []*Pod
+}
+
+// NewKubeNode create a new Kubernetes node without pods
+func NewKubeNode(name string, mon MonitorSystem) *KubeNode {
+	return &KubeNode{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+	}
+}
+
+func (n *KubeNode) GetName() string {
+	return n.Name
+}
+
+func (n *KubeNode) GetAlarms() []string {
+	serverAlarms := n.Server.GetAlarms()
+	return append(serverAlarms, "NotReady")
+}
+
+func (n *KubeNode) GetType() string {
+	return string(KubeNodeNode)
+}
+
+func (n *KubeNode) CheckAlarms(t float64) {
+	n.checkAlarm("NotReady", &n.NotReadyAlarm, t)
+	n.Server.CheckAlarms(t)
+}
+
+// Available returns true if the node is up and ready to run pods
+func (n *KubeNode) Available() bool {
+	return n.Server.Available() && !n.failed("NotReady", n.NotReadyAlarm)
+}
+
+// Cause returns the incident that made the node unavailable
+func (n *KubeNode) Cause() string {
+	if !n.Server.Available() {
+		return n.Server.Cause()
+	}
+	return n.incident("NotReady")
+}
+
+func (n *KubeNode) SetAlarm(alarm string, status AlarmStatus) {
+	switch alarm {
+	case "NotReady":
+		n.NotReadyAlarm = status
+	default:
+		n.Server.SetAlarm(alarm, status)
+	}
+}
+
+// alarmStatus return the status of any alarm of the node
+func (n *KubeNode) alarmStatus(alarm string) AlarmStatus {
+	if alarm == "NotReady" {
+		return n.NotReadyAlarm
+	}
+	return n.Server.alarmStatus(alarm)
+}
+
+// removePod take the pod out of the node
+func (n *KubeNode) removePod(pod *Pod) {
+	for i, p := range n.Pods {
+		if p == pod {
+			n.Pods = append(n.Pods[:i], n.Pods[i+1:]...)
+			return
+		}
+	}
+}
+
+// Pod is a replica of a deployment running in a node. When its node is down
+// it is rescheduled in other node after the RescheduleDelay of its
+// deployment, and it is Pending while there is no node available for it.
+// CrashLoopBackOff and OOMKilled are only triggered by faults.
+type Pod struct {
+	Server
+	// CrashLoopBackOffAlarm is True if the container is restarting again and again
+	CrashLoopBackOffAlarm AlarmStatus
+	// OOMKilledAlarm is True if the container has been killed for using too much memory
+	OOMKilledAlarm AlarmStatus
+	// PendingAlarm is True while the pod is not scheduled in any node
+	PendingAlarm AlarmStatus
+	// Node where the pod runs, nil while it is pending
+	Node       *KubeNode
+	Deployment *Deployment
+
+	// lost is the time when the pod noticed that its node is down, -1 if it is up
+	lost float64
+	// lostCause is the incident that made the node of the pod unavailable
+	lostCause string
+}
+
+// NewPod create a new pod of the deployment, not scheduled yet
+func NewPod(name string, deployment *Deployment, mon MonitorSystem) *Pod {
+	return &Pod{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+		Deployment: deployment,
+		lost:       -1,
+	}
+}
+
+func (p *Pod) GetName() string {
+	return p.Name
+}
+
+func (p *Pod) GetAlarms() []string {
+	serverAlarms := p.Server.GetAlarms()
+	return append(serverAlarms, []string{"CrashLoopBackOff", "OOMKilled", "Pending"}...)
+}
+
+func (p *Pod) GetType() string {
+	return string(PodNode)
+}
+
+// CheckAlarms check the alarms of the containers of the pod and whether its
+// node is available, rescheduling the pod after the delay if it is not.
+func (p *Pod) CheckAlarms(t float64) {
+	p.checkAlarm("CrashLoopBackOff", &p.CrashLoopBackOffAlarm, t)
+	p.checkAlarm("OOMKilled", &p.OOMKilledAlarm, t)
+
+	if p.Node != nil && (p.Node.Removed() || p.noticeDown(p.Node, t)) {
+		if p.lost < 0 {
+			p.lost = t
+			p.lostCause = p.Node.Cause()
+		}
+		if p.Deployment != nil && t-p.lost >= p.Deployment.rescheduleDelay() {
+			p.Deployment.evict(p, t)
+		}
+	} else if p.Node != nil {
+		p.lost = -1
+	}
+	if p.Node == nil && p.Deployment != nil {
+		p.Deployment.schedule(p, t)
+	}
+
+	if p.Node != nil {
+		p.PendingAlarm = AlarmEnabled
+	} else if p.PendingAlarm == AlarmEnabled {
+		p.PendingAlarm = AlarmTriggered
+		p.SetIncident("Pending", p.lostCause)
+	}
+	p.checkAlarm("Pending", &p.PendingAlarm, t)
+
+	p.Server.CheckAlarms(t)
+}
+
+// Available returns true if the pod is running in an available node and its
+// containers are not crashing
+func (p *Pod) Available() bool {
+	if p.Node == nil || p.Node.Removed() || !p.Node.Available() {
+		return false
+	}
+	return p.Server.Available() && !p.failed("CrashLoopBackOff", p.CrashLoopBackOffAlarm) && !p.failed("OOMKilled", p.OOMKilledAlarm)
+}
+
+// Cause returns the incident that made the pod unavailable
+func (p *Pod) Cause() string {
+	if p.Node == nil {
+		return p.incident("Pending")
+	}
+	if !p.Node.Available() {
+		return p.Node.Cause()
+	}
+	if !p.Server.Available() {
+		return p.Server.Cause()
+	}
+	if p.failed("CrashLoopBackOff", p.CrashLoopBackOffAlarm) {
+		return p.incident("CrashLoopBackOff")
+	}
+	return p.incident("OOMKilled")
+}
+
+func (p *Pod) SetAlarm(alarm string, status AlarmStatus) {
+	switch alarm {
+	case "CrashLoopBackOff":
+		p.CrashLoopBackOffAlarm = status
+	case "OOMKilled":
+		p.OOMKilledAlarm = status
+	case "Pending":
+		p.PendingAlarm = status
+	default:
+		p.Server.SetAlarm(alarm, status)
+	}
+}
+
+// alarmStatus return the status of any alarm of the pod
+func (p *Pod) alarmStatus(alarm string) AlarmStatus {
+	switch alarm {
+	case "CrashLoopBackOff":
+		return p.CrashLoopBackOffAlarm
+	case "OOMKilled":
+		return p.OOMKilledAlarm
+	case "Pending":
+		return p.PendingAlarm
+	}
+	return p.Server.alarmStatus(alarm)
+}
+
+// Deployment is a set of replicas of the same pod, scheduled in the Nodes.
+// It raises ReplicasUnavailable while less than MinReady pods are available,
+// as a warning while some of them are available and critical when none is.
+type Deployment struct {
+	Server
+	// ReplicasUnavailableAlarm is True while there are less than MinReady pods available
+	ReplicasUnavailableAlarm AlarmStatus
+	Pods                     []*Pod
+	// Nodes where the pods could be scheduled
+	Nodes []*KubeNode
+	// MinReady is the number of pods that should be available. All of them by default.
+	MinReady int
+	// RescheduleDelay is the time since a node is down until its pods are
+	// scheduled in other nodes. DefaultRescheduleDelay if 0.
+	RescheduleDelay float64
+
+	// arch is the architecture of the deployment, to record the changes of
+	// the topology when the pods are rescheduled
+	arch *Architecture
+}
+
+// NewDeployment create a new deployment with the given number of pods,
+// named like the deployment with the number of replica as suffix, scheduled
+// in the nodes
+func NewDeployment(name string, mon MonitorSystem, replicas int, nodes ...*KubeNode) *Deployment {
+	d := &Deployment{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+		Nodes: nodes,
+	}
+	for i := 0; i < replicas; i++ {
+		pod := NewPod(fmt.Sprintf("%s-%d", name, i), d, mon)
+		d.Pods = append(d.Pods, pod)
+		d.schedule(pod, 0)
+	}
+	return d
+}
+
+func (d *Deployment) GetName() string {
+	return d.Name
+}
+
+// GetAlarms return only the alarms of the deployment, it is not a server by itself
+func (d *Deployment) GetAlarms() []string {
+	return []string{"ReplicasUnavailable"}
+}
+
+func (d *Deployment) GetType() string {
+	return string(DeploymentNode)
+}
+
+// minReady return the number of pods that should be available
+func (d *Deployment) minReady() int {
+	if d.MinReady <= 0 || d.MinReady > len(d.Pods) {
+		return len(d.Pods)
+	}
+	return d.MinReady
+}
+
+func (d *Deployment) rescheduleDelay() float64 {
+	if d.RescheduleDelay == 0 {
+		return DefaultRescheduleDelay
+	}
+	return d.RescheduleDelay
+}
+
+// schedule the pod in the available node with less pods. It returns false
+// if there is no node available.
+func (d *Deployment) schedule(pod *Pod, t float64) bool {
+	var node *KubeNode
+	for _, n := range d.Nodes {
+		if n.Removed() || !n.Available() {
+			continue
+		}
+		if node == nil || len(n.Pods) < len(node.Pods) {
+			node = n
+		}
+	}
+	if node == nil {
+		return false
+	}
+
+	pod.Node = node
+	pod.lost = -1
+	node.Pods = append(node.Pods, pod)
+	d.record(t)
+	return true
+}
+
+// evict take the pod out of its node, to be scheduled again
+func (d *Deployment) evict(pod *Pod, t float64) {
+	pod.Node.removePod(pod)
+	pod.Node = nil
+	d.record(t)
+}
+
+// record the change of the topology when a pod changes of node
+func (d *Deployment) record(t float64) {
+	if d.arch != nil && d.arch.history != nil {
+		d.arch.history.record(d.arch.graph(), t)
+	}
+}
+
+// CheckAlarms update ReplicasUnavailable with the number of pods available,
+// changing its severity with the number of pods available
+func (d *Deployment) CheckAlarms(t float64) {
+	ready := 0
+	var down *Pod
+	for _, pod := range d.Pods {
+		if !d.noticeDown(pod, t) {
+			ready++
+		} else if down == nil {
+			down = pod
+		}
+	}
+
+	if ready >= d.minReady() {
+		d.ReplicasUnavailableAlarm = AlarmEnabled
+		d.SetAlarmSeverity("ReplicasUnavailable", NoSeverity)
+	} else {
+		if d.ReplicasUnavailableAlarm == AlarmEnabled {
+			d.ReplicasUnavailableAlarm = AlarmTriggered
+			d.SetIncident("ReplicasUnavailable", down.Cause())
+		}
+		severity := NoSeverity
+		if ready > 0 {
+			severity = SeverityWarning
+		}
+		d.SetAlarmSeverity("ReplicasUnavailable", severity)
+	}
+	d.checkAlarm("ReplicasUnavailable", &d.ReplicasUnavailableAlarm, t)
+}
+
+// Available returns true if some pod of the deployment is available
+func (d *Deployment) Available() bool {
+	return !d.failed("ReplicasUnavailable", d.ReplicasUnavailableAlarm)
+}
+
+// Cause returns the incident that made the deployment unavailable
+func (d *Deployment) Cause() string {
+	return d.incident("ReplicasUnavailable")
+}
+
+func (d *Deployment) SetAlarm(alarm string, status AlarmStatus) {
+	switch alarm {
+	case "ReplicasUnavailable":
+		d.ReplicasUnavailableAlarm = status
+	default:
+		d.Server.SetAlarm(alarm, status)
+	}
+}
+
+// alarmStatus return the status of any alarm of the deployment
+func (d *Deployment) alarmStatus(alarm string) AlarmStatus {
+	if alarm == "ReplicasUnavailable" {
+		return d.ReplicasUnavailableAlarm
+	}
+	return d.Server.alarmStatus(alarm)
+}
+
+// removePod take the pod out of the deployment and its node
+func (d *Deployment) removePod(pod *Pod) {
+	for i, p := range d.Pods {
+		if p == pod {
+			d.Pods = append(d.Pods[:i], d.Pods[i+1:]...)
+			break
+		}
+	}
+	if pod.Node != nil {
+		pod.Node.removePod(pod)
+	}
+}
+
+// removeNode stop scheduling pods in the node
+func (d *Deployment) removeNode(node *KubeNode) {
+	for i, n := range d.Nodes {
+		if n == node {
+			d.Nodes = append(d.Nodes[:i], d.Nodes[i+1:]...)
+			return
+		}
+	}
+}
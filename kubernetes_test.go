@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPodRescheduled checks that the pods of a node down are rescheduled in
+// other node after the delay
+func TestPodRescheduled(t *testing.T) {
+	mon := &fakeMonSys{}
+	node0 := NewKubeNode("node0", mon)
+	node1 := NewKubeNode("node1", mon)
+	web := NewDeployment("web", mon, 2, node0, node1)
+	web.RescheduleDelay = 3
+	assert.Equal(t, node0, web.Pods[0].Node)
+	assert.Equal(t, node1, web.Pods[1].Node)
+
+	node0.PingAlarm = AlarmTriggered
+	node0.SetIncident("Ping", "node0-down-0")
+	for time := 0.0; time < 5; time++ {
+		node0.CheckAlarms(time)
+		node1.CheckAlarms(time)
+		for _, pod := range web.Pods {
+			pod.CheckAlarms(time)
+		}
+		web.CheckAlarms(time)
+	}
+
+	assert.Equal(t, []string{
+		"0,node0,Ping,problem,critical",
+		"0,web,ReplicasUnavailable,problem,warning",
+		"3,web,ReplicasUnavailable,resolved,warning",
+	}, eventLines(mon))
+	assert.Equal(t, "node0-down-0", mon.Events[1].Incident)
+	assert.Equal(t, node1, web.Pods[0].Node)
+	assert.Equal(t, []*Pod{web.Pods[1], web.Pods[0]}, node1.Pods)
+	assert.Empty(t, node0.Pods)
+}
+
+// TestPodPending checks that the pods are pending while there is no node
+// available, and the deployment is down when none of its pods is ready
+func TestPodPending(t *testing.T) {
+	mon := &fakeMonSys{}
+	node0 := NewKubeNode("node0", mon)
+	web := NewDeployment("web", mon, 2, node0)
+	web.MinReady = 1
+	web.RescheduleDelay = 1
+
+	time := 0.0
+	checkAll := func() {
+		node0.CheckAlarms(time)
+		for _, pod := range web.Pods {
+			pod.CheckAlarms(time)
+		}
+		web.CheckAlarms(time)
+		time++
+	}
+
+	// One pod crashing, still one ready
+	web.Pods[0].SetAlarm("CrashLoopBackOff", AlarmTriggered)
+	checkAll()
+	assert.Equal(t, []string{"0,web-0,CrashLoopBackOff,problem,critical"}, eventLines(mon))
+	assert.True(t, web.Available())
+
+	// The node is not ready, the pods are pending after the delay
+	node0.SetAlarm("NotReady", AlarmTriggered)
+	node0.SetIncident("NotReady", "node0-notready-0")
+	checkAll()
+	checkAll()
+	assert.Equal(t, []string{
+		"0,web-0,CrashLoopBackOff,problem,critical",
+		"1,node0,NotReady,problem,critical",
+		"1,web,ReplicasUnavailable,problem,critical",
+		"2,web-0,Pending,problem,critical",
+		"2,web-1,Pending,problem,critical",
+	}, eventLines(mon))
+	assert.Equal(t, "node0-notready-0", mon.Events[2].Incident)
+	assert.Equal(t, "node0-notready-0", mon.Events[4].Incident)
+	assert.False(t, web.Available())
+	assert.Nil(t, web.Pods[1].Node)
+
+	// The node is ready again and the pods are scheduled in it
+	node0.SetAlarm("NotReady", AlarmEnabled)
+	checkAll()
+	assert.Equal(t, node0, web.Pods[1].Node)
+	assert.True(t, web.Available())
+	assert.Len(t, node0.Pods, 2)
+}
+
+// TestDeploymentSeverity checks that ReplicasUnavailable escalates when no pod is ready
+func TestDeploymentSeverity(t *testing.T) {
+	mon := &fakeMonSys{}
+	node0 := NewKubeNode("node0", mon)
+	web := NewDeployment("web", mon, 2, node0)
+
+	web.Pods[0].SetAlarm("OOMKilled", AlarmTriggered)
+	web.CheckAlarms(0)
+	web.Pods[1].SetAlarm("CrashLoopBackOff", AlarmTriggered)
+	web.CheckAlarms(1)
+	web.Pods[0].SetAlarm("OOMKilled", AlarmEnabled)
+	web.Pods[1].SetAlarm("CrashLoopBackOff", AlarmEnabled)
+	web.CheckAlarms(2)
+
+	assert.Equal(t, []string{
+		"0,web,ReplicasUnavailable,problem,warning",
+		"1,web,ReplicasUnavailable,updated,critical",
+		"2,web,ReplicasUnavailable,resolved,critical",
+	}, eventLines(mon))
+}
+
+func TestTopologyKubernetes(t *testing.T) {
+	a := Architecture{mon: &PrinterMonitorSystem{Rand: rand.New(rand.NewSource(1))}}
+
+	topology := `kube_nodes:
+  - name: node
+    count: 2
+deployments:
+  - name: web
+    replicas: 3
+    min_ready: 2
+    reschedule_delay: 2
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+
+	if assert.Len(t, a.Deployments, 1) {
+		assert.Equal(t, 2, a.Deployments[0].MinReady)
+		assert.Equal(t, 2.0, a.Deployments[0].RescheduleDelay)
+	}
+	assert.Len(t, a.Pods, 3)
+
+	edges := func() []string {
+		return edgeLines(&a, MemberEdge, ScheduledEdge)
+	}
+	assert.ElementsMatch(t, []string{
+		"member:web-web-0", "member:web-web-1", "member:web-web-2",
+		"scheduled:web-0-node0", "scheduled:web-1-node1", "scheduled:web-2-node0",
+	}, edges())
+
+	// The pods of node0 are rescheduled in node1 during the simulation
+	a.AddFault(&Fault{Name: "node0-down", Target: "node0", Alarm: "Ping", Start: Constant(10), Duration: Constant(1000)})
+	a.Start(60)
+	assert.ElementsMatch(t, []string{
+		"member:web-web-0", "member:web-web-1", "member:web-web-2",
+		"scheduled:web-0-node1", "scheduled:web-1-node1", "scheduled:web-2-node1",
+	}, edges())
+
+	a.GraphOptions = GraphOptions{Intervals: true}
+	assert.Contains(t, edges(), "scheduled:web-0-node0")
+}
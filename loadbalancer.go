@@ -0,0 +1,268 @@
+package main
+
+// LoadBalancer distribute the requests between several frontends.
+// It is available while at least one of them is available.
+//
+// It could also have a pool of Members of any type, like backends. Each
+// member has a health check alarm, the pool is degraded when less than
+// MinMembers are available and it is down when none of them is.
+type LoadBalancer struct {
+	Server
+	// ProcAlarm is True if the load balancer process is not running
+	ProcAlarm AlarmStatus
+	// FrontendConnectionAlarm is True if none of the frontends is available
+	FrontendConnectionAlarm AlarmStatus
+	Frontends               []*Frontend
+	// Members is the pool of servers behind the load balancer
+	Members []Service
+	// MinMembers is the number of available members needed to not raise
+	// PoolDegraded. All the members by default.
+	MinMembers int
+
+	// pool is the status of the health checks and the pool alarms
+	pool map[string]AlarmStatus
+	// leaving are the health checks of the members taken out of the pool,
+	// resolved in the next check if they were triggered
+	leaving []string
+}
+
+// HealthCheckAlarm return the name of the health check alarm of a member of the pool
+func HealthCheckAlarm(member string) string {
+	return "HealthCheck:" + member
+}
+
+// NewLoadBalancer create a new load balancer in front of the frontends
+func NewLoadBalancer(name string, mon MonitorSystem, frontends ...*Frontend) *LoadBalancer {
+	return &LoadBalancer{
+		Server: Server{
+			Name: name,
+			mon:  mon,
+		},
+		Frontends: frontends,
+	}
+}
+
+// NewLoadBalancerPool create a new load balancer with a pool of members
+func NewLoadBalancerPool(name string, mon MonitorSystem, members ...Service) *LoadBalancer {
+	l := NewLoadBalancer(name, mon)
+	for _, member := range members {
+		l.AddMember(member)
+	}
+	return l
+}
+
+func (l *LoadBalancer) AddFrontend(frontend *Frontend) {
+	l.Frontends = append(l.Frontends, frontend)
+}
+
+// RemoveFrontend stop sending requests to the frontend
+func (l *LoadBalancer) RemoveFrontend(frontend *Frontend) {
+	for i, f := range l.Frontends {
+		if f == frontend {
+			l.Frontends = append(l.Frontends[:i], l.Frontends[i+1:]...)
+			return
+		}
+	}
+}
+
+// AddMember add the server to the pool. Its health check alarm, like
+// PoolDegraded, is a warning unless other severity is set.
+func (l *LoadBalancer) AddMember(member Service) {
+	l.Members = append(l.Members, member)
+	for _, alarm := range []string{"PoolDegraded", HealthCheckAlarm(member.GetName())} {
+		if l.Severities[alarm] == NoSeverity {
+			l.SetSeverity(alarm, SeverityWarning)
+		}
+	}
+}
+
+// RemoveMember take the server out of the pool
+func (l *LoadBalancer) RemoveMember(member Service) {
+	for i, m := range l.Members {
+		if m == member {
+			l.Members = append(l.Members[:i], l.Members[i+1:]...)
+			l.leaving = append(l.leaving, HealthCheckAlarm(member.GetName()))
+			return
+		}
+	}
+}
+
+func (l *LoadBalancer) GetName() string {
+	return l.Name
+}
+
+func (l *LoadBalancer) GetAlarms() []string {
+	serverAlarms := l.Server.GetAlarms()
+	return append(append(serverAlarms, []string{"Proc", "FrontendConnection"}...), l.poolAlarms()...)
+}
+
+// poolAlarms return the alarms of the pool, none if it has no members
+func (l *LoadBalancer) poolAlarms() []string {
+	if len(l.Members) == 0 {
+		return nil
+	}
+	alarms := []string{"PoolDegraded", "PoolDown"}
+	for _, member := range l.Members {
+		alarms = append(alarms, HealthCheckAlarm(member.GetName()))
+	}
+	return alarms
+}
+
+// minMembers return the number of members that should be available
+func (l *LoadBalancer) minMembers() int {
+	if l.MinMembers <= 0 || l.MinMembers > len(l.Members) {
+		return len(l.Members)
+	}
+	return l.MinMembers
+}
+
+// checkPool update the health check of each member and the alarms of the
+// pool, with the number of members available
+func (l *LoadBalancer) checkPool(t float64) {
+	if l.pool == nil {
+		l.pool = make(map[string]AlarmStatus)
+	}
+
+	available := 0
+	var down Service
+	for _, member := range l.Members {
+		alarm := HealthCheckAlarm(member.GetName())
+		if !l.noticeDown(member, t) {
+			l.pool[alarm] = AlarmEnabled
+			available++
+			continue
+		}
+		if l.pool[alarm] == AlarmEnabled {
+			l.pool[alarm] = AlarmTriggered
+			l.SetIncident(alarm, member.Cause())
+		}
+		if down == nil {
+			down = member
+		}
+	}
+
+	// The pool alarms use the cause of the first member down. An empty pool
+	// is neither degraded nor down.
+	update := func(alarm string, ok bool) {
+		if ok || down == nil {
+			l.pool[alarm] = AlarmEnabled
+		} else if l.pool[alarm] == AlarmEnabled {
+			l.pool[alarm] = AlarmTriggered
+			l.SetIncident(alarm, down.Cause())
+		}
+	}
+	update("PoolDegraded", available >= l.minMembers())
+	update("PoolDown", available > 0)
+
+	alarms := []string{"PoolDegraded", "PoolDown"}
+	for _, member := range l.Members {
+		alarms = append(alarms, HealthCheckAlarm(member.GetName()))
+	}
+	for _, alarm := range alarms {
+		status := l.pool[alarm]
+		l.checkAlarm(alarm, &status, t)
+		l.pool[alarm] = status
+	}
+
+	for _, alarm := range l.leaving {
+		status := AlarmEnabled
+		l.checkAlarm(alarm, &status, t)
+		delete(l.pool, alarm)
+	}
+	l.leaving = nil
+}
+
+func (l *LoadBalancer) GetType() string {
+	return string(LBNode)
+}
+
+// availableFrontend return the first frontend available, or nil if all are
+// down. All the frontends are checked to notice their failures.
+func (l *LoadBalancer) availableFrontend(t float64) *Frontend {
+	var available *Frontend
+	for _, frontend := range l.Frontends {
+		if !l.noticeDown(frontend, t) && available == nil {
+			available = frontend
+		}
+	}
+	return available
+}
+
+// CheckAlarms print a message if the server has alarms.
+// It check alarms specific to the load balancer, plus generic alarms for the
+// server and also generate an alarm if none of the frontends is available.
+func (l *LoadBalancer) CheckAlarms(t float64) {
+	l.checkAlarm("Proc", &l.ProcAlarm, t)
+
+	if len(l.Frontends) == 0 || l.availableFrontend(t) != nil {
+		l.FrontendConnectionAlarm = AlarmEnabled
+	} else if l.FrontendConnectionAlarm == AlarmEnabled {
+		l.FrontendConnectionAlarm = AlarmTriggered
+		// All the frontends are down, use the cause of the first one
+		l.SetIncident("FrontendConnection", l.Frontends[0].Cause())
+	}
+	l.checkAlarm("FrontendConnection", &l.FrontendConnectionAlarm, t)
+
+	if len(l.Members) > 0 || len(l.pool) > 0 {
+		l.checkPool(t)
+	}
+
+	l.Server.CheckAlarms(t)
+}
+
+// Available returns true if the load balancer is running and at least one of
+// its frontends, and of the members of its pool, is available
+func (l *LoadBalancer) Available() bool {
+	return l.Server.Available() && !l.failed("Proc", l.ProcAlarm) && !l.failed("FrontendConnection", l.FrontendConnectionAlarm) &&
+		!l.failed("PoolDown", l.pool["PoolDown"])
+}
+
+// Cause returns the incident that made the load balancer unavailable
+func (l *LoadBalancer) Cause() string {
+	if !l.Server.Available() {
+		return l.Server.Cause()
+	}
+	if l.failed("Proc", l.ProcAlarm) {
+		return l.incident("Proc")
+	}
+	if l.failed("PoolDown", l.pool["PoolDown"]) {
+		return l.incident("PoolDown")
+	}
+	return l.incident("FrontendConnection")
+}
+
+func (l *LoadBalancer) SetAlarm(alarm string, status AlarmStatus) {
+	switch alarm {
+	case "Proc":
+		l.ProcAlarm = status
+	case "FrontendConnection":
+		l.FrontendConnectionAlarm = status
+	default:
+		for _, a := range l.poolAlarms() {
+			if a == alarm {
+				if l.pool == nil {
+					l.pool = make(map[string]AlarmStatus)
+				}
+				l.pool[alarm] = status
+				return
+			}
+		}
+		l.Server.SetAlarm(alarm, status)
+	}
+}
+
+// alarmStatus return the status of any alarm of the load balancer
+func (l *LoadBalancer) alarmStatus(alarm string) AlarmStatus {
+	switch alarm {
+	case "Proc":
+		return l.ProcAlarm
+	case "FrontendConnection":
+		return l.FrontendConnectionAlarm
+	}
+	for _, a := range l.poolAlarms() {
+		if a == alarm {
+			return l.pool[alarm]
+		}
+	}
+	return l.Server.alarmStatus(alarm)
+}
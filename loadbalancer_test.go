@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBalancerAlarm(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1, Transitive: true}
+	frontend1 := &Frontend{Server: Server{Name: "frontend1", mon: mon}, Backend: backend1, Transitive: true}
+	frontend2 := &Frontend{Server: Server{Name: "frontend2", mon: mon}, Backend: backend1}
+	lb := NewLoadBalancer("lb1", mon, frontend1, frontend2)
+
+	time := 0.0
+	checkAll := func() {
+		db1.CheckAlarms(time)
+		backend1.CheckAlarms(time)
+		frontend1.CheckAlarms(time)
+		frontend2.CheckAlarms(time)
+		lb.CheckAlarms(time)
+		time++
+	}
+
+	// One frontend down, the load balancer still works with the other one
+	frontend2.PingAlarm = AlarmTriggered
+	checkAll()
+	assert.Equal(t, []string{"0,frontend2,Ping"}, mon.Alarms)
+	assert.True(t, lb.Available())
+
+	// The failure of the db reaches the load balancer through the backend and the frontend
+	db1.PingAlarm = AlarmTriggered
+	db1.SetIncident("Ping", "db1-down-0")
+	checkAll()
+	assert.Equal(t, []string{
+		"0,frontend2,Ping",
+		"1,db1,Ping",
+		"1,backend1,DBConnection",
+		"1,frontend1,BackendConnection",
+		"1,frontend2,BackendConnection",
+		"1,lb1,FrontendConnection",
+	}, mon.Alarms)
+	assert.False(t, lb.Available())
+	assert.Equal(t, "db1-down-0", lb.Cause())
+}
+
+// TestLoadBalancerPool checks that losing one member of the pool is a warning
+// and losing all of them is an outage
+func TestLoadBalancerPool(t *testing.T) {
+	mon := &fakeMonSys{}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backends := []*Backend{}
+	members := []Service{}
+	for i := 0; i < 3; i++ {
+		backend := &Backend{Server: Server{Name: fmt.Sprintf("backend%d", i), mon: mon}, DBEngine: db1}
+		backends = append(backends, backend)
+		members = append(members, backend)
+	}
+	lb := NewLoadBalancerPool("lb1", mon, members...)
+	frontend1 := NewPoolFrontend("frontend1", lb, mon)
+
+	time := 0.0
+	checkAll := func() {
+		for _, backend := range backends {
+			backend.CheckAlarms(time)
+		}
+		lb.CheckAlarms(time)
+		frontend1.CheckAlarms(time)
+		time++
+	}
+
+	// One member down: health check and degraded pool as warnings
+	backends[0].PingAlarm = AlarmTriggered
+	backends[0].SetIncident("Ping", "backend0-down-0")
+	checkAll()
+	assert.Equal(t, []string{
+		"0,backend0,Ping,problem,critical",
+		"0,lb1,PoolDegraded,problem,warning",
+		"0,lb1,HealthCheck:backend0,problem,warning",
+	}, eventLines(mon))
+	assert.True(t, lb.Available())
+
+	// All the members down: the pool is down, and the frontend loses its connection
+	backends[1].PingAlarm = AlarmTriggered
+	backends[2].ProcAlarm = AlarmTriggered
+	checkAll()
+	assert.Equal(t, []string{
+		"1,backend1,Ping",
+		"1,backend2,Proc",
+		"1,lb1,PoolDown",
+		"1,lb1,HealthCheck:backend1",
+		"1,lb1,HealthCheck:backend2",
+		"1,frontend1,BackendConnection",
+	}, mon.Alarms[3:])
+	assert.False(t, lb.Available())
+	// The pool uses the cause of the first member down
+	assert.Equal(t, "backend0-down-0", lb.Cause())
+	assert.Equal(t, "backend0-down-0", mon.Events[len(mon.Events)-1].Incident)
+
+	// The pool is degraded again when some member recovers
+	backends[1].PingAlarm = AlarmEnabled
+	checkAll()
+	assert.True(t, lb.Available())
+	assert.Equal(t, []string{
+		"2,backend1,Ping,resolved,critical",
+		"2,lb1,PoolDown,resolved,critical",
+		"2,lb1,HealthCheck:backend1,resolved,warning",
+		"2,frontend1,BackendConnection,resolved,critical",
+	}, eventLines(mon)[9:])
+}
+
+// TestLoadBalancerMinMembers checks that the pool is not degraded while it has the minimum of members
+func TestLoadBalancerMinMembers(t *testing.T) {
+	mon := &fakeMonSys{}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	srv2 := &Server{Name: "srv2", mon: mon}
+	srv3 := &Server{Name: "srv3", mon: mon}
+	lb := NewLoadBalancerPool("lb1", mon, srv1, srv2, srv3)
+	lb.MinMembers = 2
+
+	srv1.PingAlarm = AlarmTriggered
+	lb.CheckAlarms(0)
+	assert.Equal(t, []string{"0,lb1,HealthCheck:srv1"}, mon.Alarms)
+
+	srv2.PingAlarm = AlarmTriggered
+	lb.CheckAlarms(1)
+	assert.Equal(t, []string{"0,lb1,HealthCheck:srv1", "1,lb1,PoolDegraded", "1,lb1,HealthCheck:srv2"}, mon.Alarms)
+	assert.True(t, lb.Available())
+}
+
+// TestLoadBalancerRemoveMember checks that the alarms of the members taken out
+// of the pool are resolved, and that an empty pool is not down
+func TestLoadBalancerRemoveMember(t *testing.T) {
+	mon := &fakeMonSys{}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	srv2 := &Server{Name: "srv2", mon: mon}
+	lb := NewLoadBalancerPool("lb1", mon, srv1, srv2)
+
+	srv1.PingAlarm = AlarmTriggered
+	lb.CheckAlarms(0)
+	lb.RemoveMember(srv1)
+	lb.CheckAlarms(1)
+	assert.Equal(t, []string{
+		"0,lb1,PoolDegraded,problem,warning",
+		"0,lb1,HealthCheck:srv1,problem,warning",
+		"1,lb1,PoolDegraded,resolved,warning",
+		"1,lb1,HealthCheck:srv1,resolved,warning",
+	}, eventLines(mon))
+
+	srv2.PingAlarm = AlarmTriggered
+	lb.CheckAlarms(2)
+	assert.False(t, lb.Available())
+	lb.RemoveMember(srv2)
+	lb.CheckAlarms(3)
+	assert.True(t, lb.Available())
+	assert.Equal(t, []string{
+		"2,lb1,PoolDegraded,problem,warning",
+		"2,lb1,PoolDown,problem,critical",
+		"2,lb1,HealthCheck:srv2,problem,warning",
+		"3,lb1,PoolDegraded,resolved,warning",
+		"3,lb1,PoolDown,resolved,critical",
+		"3,lb1,HealthCheck:srv2,resolved,warning",
+	}, eventLines(mon)[4:])
+}
+
+func TestLoadBalancerPoolGraph(t *testing.T) {
+	a := Architecture{mon: &PrinterMonitorSystem{Rand: rand.New(rand.NewSource(1))}}
+
+	topology := `databases:
+  - name: db1
+backends:
+  - name: backend
+    count: 2
+    database: db1
+loadbalancers:
+  - name: lb1
+    members: [backend0, backend1]
+    min_members: 1
+frontends:
+  - name: frontend1
+    loadbalancer: lb1
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+	assert.Equal(t, 1, a.LoadBalancers[0].MinMembers)
+	assert.Equal(t, a.LoadBalancers[0], a.Frontends[0].LoadBalancer)
+	assert.Equal(t, SeverityWarning, a.LoadBalancers[0].BaseSeverity("HealthCheck:backend0"))
+
+	alarms := []string{}
+	for _, n := range a.CytoscapeJSON().Elements.Nodes {
+		if n.Data["type"] == string(AlarmNode) && strings.HasPrefix(n.Data["name"].(string), "lb1-") {
+			alarms = append(alarms, n.Data["label"].(string))
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"connect:backend0-db1", "connect:backend1-db1", "connect:frontend1-lb1", "connect:lb1-backend0", "connect:lb1-backend1",
+	}, edgeLines(&a, ConnectEdge))
+	assert.Equal(t, []string{
+		"CPU", "Memory", "Disk", "Ping", "DNS", "Proc", "FrontendConnection",
+		"PoolDegraded", "PoolDown", "HealthCheck:backend0", "HealthCheck:backend1",
+	}, alarms)
+
+	// The removed members are taken out of the pool
+	a.RemoveServer("backend0")
+	assert.Equal(t, []Service{a.Backends[0]}, a.LoadBalancers[0].Members)
+}
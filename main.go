@@ -1,4 +1,3 @@
-//
 // Simulate a monitoring system where different kind of servers are interconnected
 // and have alarms that can be triggered.
 //
@@ -8,11 +7,15 @@
 // based of the status of other connected servers.
 // For example, a backend server has an alarm that triggers when the connection
 // to the database is lost. This alarm is based on the status on the db.
+//
+// Usage:
+//
+//	ghostpipe list
+//	ghostpipe run --dataset DBCluster --duration 2d --seed 42
+//	ghostpipe graph --dataset DBCluster --graphml graph.graphml
 package main
 
 import (
-	"flag"
-	"fmt"
 	"os"
 )
 
@@ -35,51 +38,6 @@ const (
 	IntervalJitter = 0.2
 )
 
-// Create flags to define graph and events output files
-var (
-	graphMLFile = flag.String("graphml", "graph.graphml", "File to save the graph in GraphML format")
-	eventsFile  = flag.String("events", "events.csv", "File to save the events in CSV format")
-)
-
 func main() {
-	flag.Parse()
-
-	// Create the monitoring system
-	mon := &PrinterMonitorSystem{}
-
-	// Create the architecture
-	a := Architecture{mon: mon}
-
-	// Select which topology to use (uncomment the one you want to use)
-	// MiniBackendFrontendNoise(&a)
-	// BackendFrontendNoise(&a)
-	// DBCluster(&a)
-	RelacionesInesperadas(&a)
-
-	// Output the graph in different formats
-	if *graphMLFile != "" {
-		gFile, err := os.Create(*graphMLFile)
-		if err != nil {
-			panic(err)
-		}
-		defer gFile.Close()
-
-		gml := a.GraphML()
-		fmt.Printf("Writing GraphML graph to %s\n", *graphMLFile)
-		err = gml.Encode(gFile, true)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	// Start the simulation.
-	fmt.Println("Starting simulator...")
-
-	// Run the simulation for this long
-	a.Start(60.0 * 24 * 2)
-	fmt.Println("Simulator finished")
-
-	// Write generated events to file
-	fmt.Printf("Writing events to file %s\n", *eventsFile)
-	mon.WriteEvents(*eventsFile)
+	os.Exit(runCLI(os.Args[1:]))
 }
@@ -2,11 +2,12 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
-
-	"github.com/fschuetz04/simgo"
 )
 
+func init() {
+	RegisterDataset("MiniBackendFrontendNoise", "Una DB con dos backends, cada uno con un frontend, y cinco nodos de ruido. Se tira la DB cada 60'", MiniBackendFrontendNoise)
+}
+
 // BackendFrontendNoise es una topología que simula dos bases de datos donde hay
 // conectados backends y frontends a esos backends.
 // Luego tenemos varios servidores aislados con sus alarmas.
@@ -33,39 +34,15 @@ func MiniBackendFrontendNoise(a *Architecture) {
 	_ = frontendB1
 
 	// Disconnect db1 each 60' and reconnect it after 5'
-	a.AddMonkey(func(proc simgo.Process) {
-		proc.Wait(proc.Timeout(60))
-		for {
-			// fmt.Println("\nmonkey: disconnect db1")
-			db1.PingAlarm = AlarmTriggered
-
-			proc.Wait(proc.Timeout(5))
-			// fmt.Println("\nmonkey: reconnect db1")
-			db1.PingAlarm = AlarmEnabled
-
-			proc.Wait(proc.Timeout(55))
-		}
+	a.AddFault(&Fault{
+		Name:     "db1-down",
+		Target:   db1.Name,
+		Alarm:    "Ping",
+		Start:    Constant(60),
+		Duration: Constant(5),
+		Period:   Constant(60),
 	})
 
-	// Generate alarm noise
-	a.AddMonkey(func(proc simgo.Process) {
-		for {
-			// Get one of the noise servers
-			noiseServer := noiseServers[rand.Intn(len(noiseServers))]
-
-			// Trigger one the alarms of the server
-			switch rand.Intn(4) {
-			case 0:
-				noiseServer.CPUAlarm = AlarmTriggered
-			case 1:
-				noiseServer.MemoryAlarm = AlarmTriggered
-			case 2:
-				noiseServer.DiskAlarm = AlarmTriggered
-			case 3:
-				noiseServer.PingAlarm = AlarmTriggered
-			}
-
-			proc.Wait(proc.Timeout(1))
-		}
-	})
+	// Generate alarm noise: each minute trigger one of the alarms of one of the noise servers
+	a.AddFault(NoiseFault(noiseServers))
 }
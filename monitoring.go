@@ -1,23 +1,53 @@
 package main
 
 import (
-	"fmt"
 	"math/rand"
-	"os"
 	"sync"
 )
 
+// NoiseIncident is the incident of the events not caused by an injected fault
+const NoiseIncident = "noise"
+
+// EventState is the stage of the alarm lifecycle reported by an event
+type EventState string
+
+const (
+	// ProblemState is reported when an alarm is triggered
+	ProblemState EventState = "problem"
+	// ResolvedState is reported when a triggered alarm is enabled again
+	ResolvedState EventState = "resolved"
+	// UpdatedState is reported when the severity of a triggered alarm changes
+	UpdatedState EventState = "updated"
+)
+
+// Event is the message sent by a server to the monitoring system when one of
+// its alarms is triggered or resolved
+type Event struct {
+	Time   float64
+	Server string
+	Alarm  string
+	// Incident identifies the injected fault that caused the event (ground truth),
+	// or NoiseIncident if the event is not related to any fault
+	Incident string
+	State    EventState
+	Severity Severity
+}
+
 type MonitorSystem interface {
-	handleAlarm(string, string, float64)
+	handleAlarm(Event)
 	generateEventID(string, string) int
 }
 
-// MoMonitorSystem receive the alarms of the servers and generate messages
+// MoMonitorSystem receive the alarms of the servers and write them to the sink
 type PrinterMonitorSystem struct {
 	sync.Mutex
+	// Rand is the random generator used to generate the event IDs
+	Rand *rand.Rand
+	// Sink receive the events as they are generated. Use a MultiSink to
+	// write them to several outputs.
+	Sink    EventSink
 	eventid map[string]int
 	usedIDs map[int]bool
-	events  []string
 }
 
 func (m *PrinterMonitorSystem) generateEventID(server string, alarm string) int {
@@ -38,7 +68,7 @@ func (m *PrinterMonitorSystem) generateEventID(server string, alarm string) int
 
 	// Generate a random integer
 	for {
-		id := rand.Intn(1000000)
+		id := m.Rand.Intn(1000000)
 		if !m.usedIDs[id] {
 			m.usedIDs[id] = true
 			m.eventid[server+alarm] = id
@@ -47,38 +77,16 @@ func (m *PrinterMonitorSystem) generateEventID(server string, alarm string) int
 	}
 }
 
-func (m *PrinterMonitorSystem) handleAlarm(server string, alarm string, time float64) {
+// handleAlarm send the event to the sink as soon as it is generated
+func (m *PrinterMonitorSystem) handleAlarm(event Event) {
 	m.Lock()
 	defer m.Unlock()
 
-	// Get time in unix epoch format
-	e := fmt.Sprintf("%.0f,%s,%s,%v\n", time*60, server, alarm, m.generateEventID(server, alarm))
-
-	m.events = append(m.events, e)
-}
-
-func (m *PrinterMonitorSystem) WriteEvents(fileName string) {
-	// Delete the events file if it exists
-	if _, err := os.Stat(fileName); err == nil {
-		os.Remove(fileName)
+	eventid := m.generateEventID(event.Server, event.Alarm)
+	if m.Sink == nil {
+		return
 	}
-
-	// File where events will be saved
-	f, err := os.Create(fileName)
-	if err != nil {
+	if err := m.Sink.WriteEvent(event, eventid); err != nil {
 		panic(err)
 	}
-	defer f.Close()
-
-	// Write the CSV header for the events file
-	_, err = f.WriteString("time,server,alarm,eventid\n")
-	if err != nil {
-		panic(err)
-	}
-	for _, e := range m.events {
-		_, err := f.WriteString(e)
-		if err != nil {
-			panic(err)
-		}
-	}
 }
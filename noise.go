@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/fschuetz04/simgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Noise generates alarms not related to any incident in the servers of the
+// architecture. Each rule has its own rate, targets and alarms, so the noise
+// could be different for each type of node and alarm.
+type Noise struct {
+	Name  string       `yaml:"name"`
+	Rules []*NoiseRule `yaml:"rules"`
+	// Seasonality changes the rate of all the rules with the time of the day and the day of the week
+	Seasonality *Seasonality `yaml:"seasonality"`
+
+	line int
+}
+
+func (n *Noise) UnmarshalYAML(value *yaml.Node) error {
+	type plain Noise
+	n.line = value.Line
+	return value.Decode((*plain)(n))
+}
+
+// NoiseRule generates noise alarms as a Poisson process, optionally in bursts
+type NoiseRule struct {
+	// Types and Servers select the servers by node type or by name. If both
+	// are empty, the rule applies to every server of the architecture.
+	Types   []string `yaml:"types"`
+	Servers []string `yaml:"servers"`
+	// Alarms triggered by the rule, one at random each time. By default CPU,
+	// Memory, Disk and Ping. Servers without any of them are ignored.
+	Alarms []string `yaml:"alarms"`
+	// Rate is the mean number of alarms (or bursts) per hour in each server
+	Rate float64 `yaml:"rate"`
+	// Duration is the time the alarms stay triggered. By default an exponential with mean 5'.
+	Duration *Distribution `yaml:"duration"`
+	// Burst is the number of alarms of each arrival, in different random servers. One by default.
+	Burst *Distribution `yaml:"burst"`
+	// BurstSpread is the time between the alarms of a burst. 0 by default.
+	BurstSpread *Distribution `yaml:"burst_spread"`
+	// Correlated are alarms of the same server that follow the noise alarms,
+	// like Memory after CPU
+	Correlated []*CorrelatedNoise `yaml:"correlated"`
+}
+
+// CorrelatedNoise trigger Alarm with some probability after a noise alarm When in the same server
+type CorrelatedNoise struct {
+	When        string  `yaml:"when"`
+	Alarm       string  `yaml:"alarm"`
+	Probability float64 `yaml:"probability"`
+	// Delay since the When alarm is triggered. 0 by default.
+	Delay *Distribution `yaml:"delay"`
+}
+
+// Seasonality are multipliers of the rate of the noise. The simulation starts
+// at the first hour of the first day.
+type Seasonality struct {
+	// Daily is the multiplier for each hour of the day (24 values)
+	Daily []float64 `yaml:"daily"`
+	// Weekly is the multiplier for each day of the week (7 values)
+	Weekly []float64 `yaml:"weekly"`
+}
+
+// OfficeHoursSeasonality return a seasonality with more noise during the
+// working hours of the working days, and less at night and in the weekend
+func OfficeHoursSeasonality() *Seasonality {
+	return &Seasonality{
+		Daily: []float64{
+			0.3, 0.3, 0.3, 0.3, 0.3, 0.4, 0.6, 0.8, // 00-07
+			1.5, 2, 2, 2, 1.5, 1.5, 2, 2, 1.5, 1.2, // 08-17
+			1, 0.8, 0.6, 0.5, 0.4, 0.3, // 18-23
+		},
+		Weekly: []float64{1, 1, 1, 1, 1, 0.4, 0.3},
+	}
+}
+
+// factor return the multiplier of the rate at time t
+func (s *Seasonality) factor(t float64) float64 {
+	if s == nil {
+		return 1
+	}
+	f := 1.0
+	if len(s.Daily) > 0 {
+		f *= s.Daily[int(t/60)%24]
+	}
+	if len(s.Weekly) > 0 {
+		f *= s.Weekly[int(t/(24*60))%7]
+	}
+	return f
+}
+
+// max return the maximum multiplier
+func (s *Seasonality) max() float64 {
+	if s == nil {
+		return 1
+	}
+	maxOf := func(values []float64) float64 {
+		m := 1.0
+		if len(values) > 0 {
+			m = 0
+		}
+		for _, v := range values {
+			m = math.Max(m, v)
+		}
+		return m
+	}
+	return maxOf(s.Daily) * maxOf(s.Weekly)
+}
+
+func (s *Seasonality) validate() error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Daily) != 0 && len(s.Daily) != 24 {
+		return fmt.Errorf("daily seasonality should have 24 values, not %d", len(s.Daily))
+	}
+	if len(s.Weekly) != 0 && len(s.Weekly) != 7 {
+		return fmt.Errorf("weekly seasonality should have 7 values, not %d", len(s.Weekly))
+	}
+	for _, v := range append(append([]float64{}, s.Daily...), s.Weekly...) {
+		if v < 0 {
+			return fmt.Errorf("negative seasonality %v", v)
+		}
+	}
+	return nil
+}
+
+// alarms return the alarms of the rule, with the default ones
+func (r *NoiseRule) alarms() []string {
+	if len(r.Alarms) == 0 {
+		return []string{"CPU", "Memory", "Disk", "Ping"}
+	}
+	return r.Alarms
+}
+
+// targets return the servers of the architecture selected by the rule
+func (r *NoiseRule) targets(a *Architecture) []MonitoredServer {
+	targets := []MonitoredServer{}
+	for _, server := range a.GetAllServers() {
+		s, ok := server.(ArchitectureServer)
+		if !ok {
+			continue
+		}
+		selected := len(r.Types) == 0 && len(r.Servers) == 0
+		for _, typ := range r.Types {
+			selected = selected || s.GetType() == typ
+		}
+		for _, name := range r.Servers {
+			selected = selected || s.GetName() == name
+		}
+		if selected {
+			targets = append(targets, server)
+		}
+	}
+	return targets
+}
+
+func (r *NoiseRule) validate() error {
+	if r.Rate <= 0 {
+		return fmt.Errorf("noise rule without rate")
+	}
+	for _, c := range r.Correlated {
+		if c.Alarm == "" {
+			return fmt.Errorf("correlated noise without alarm")
+		}
+		if c.Probability < 0 || c.Probability > 1 {
+			return fmt.Errorf("invalid correlated noise probability %v, it should be between 0 and 1", c.Probability)
+		}
+	}
+	return nil
+}
+
+// Monkey compile the noise into a simulation process for the architecture.
+// The servers of each rule are selected each time, so servers added or
+// removed during the simulation are taken into account.
+func (n *Noise) Monkey(a *Architecture) (func(simgo.Process), error) {
+	if len(n.Rules) == 0 {
+		return nil, fmt.Errorf("noise %q without rules", n.Name)
+	}
+	if err := n.Seasonality.validate(); err != nil {
+		return nil, fmt.Errorf("noise %q: %v", n.Name, err)
+	}
+	for _, rule := range n.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("noise %q: %v", n.Name, err)
+		}
+	}
+
+	r := a.Rand()
+	return func(proc simgo.Process) {
+		for _, rule := range n.Rules {
+			proc.Process(n.ruleProcess(a, r, rule))
+		}
+	}, nil
+}
+
+// ruleProcess generate the arrivals of the rule. The rate changes with the
+// number of servers and the seasonality, so the arrivals are generated at
+// the maximum rate and only some of them are accepted (thinning).
+func (n *Noise) ruleProcess(a *Architecture, r *rand.Rand, rule *NoiseRule) func(simgo.Process) {
+	return func(proc simgo.Process) {
+		maxFactor := n.Seasonality.max()
+		if maxFactor == 0 {
+			return
+		}
+
+		for {
+			targets := rule.targets(a)
+			if len(targets) == 0 {
+				// Wait for new servers
+				proc.Wait(proc.Timeout(60))
+				continue
+			}
+
+			// Rate per minute of all the servers
+			rate := rule.Rate / 60 * float64(len(targets)) * maxFactor
+			proc.Wait(proc.Timeout(r.ExpFloat64() / rate))
+			if r.Float64()*maxFactor >= n.Seasonality.factor(proc.Now()) {
+				continue
+			}
+
+			burst := 1
+			if rule.Burst != nil {
+				burst = int(math.Max(math.Round(rule.Burst.Sample(r)), 1))
+			}
+			proc.Process(n.burstProcess(a, r, rule, burst))
+		}
+	}
+}
+
+// burstProcess trigger the alarms of a burst in different random servers
+func (n *Noise) burstProcess(a *Architecture, r *rand.Rand, rule *NoiseRule, burst int) func(simgo.Process) {
+	return func(proc simgo.Process) {
+		used := map[MonitoredServer]bool{}
+		for i := 0; i < burst; i++ {
+			if i > 0 && rule.BurstSpread != nil {
+				proc.Wait(proc.Timeout(rule.BurstSpread.Sample(r)))
+			}
+
+			// Each alarm of the burst in a different server
+			targets := []MonitoredServer{}
+			for _, server := range rule.targets(a) {
+				if !used[server] {
+					targets = append(targets, server)
+				}
+			}
+			if len(targets) == 0 {
+				return
+			}
+			server := targets[r.Intn(len(targets))]
+			used[server] = true
+
+			// Only alarms not already raised by a fault or other noise
+			alarms := []string{}
+			for _, alarm := range rule.alarms() {
+				if hasAlarm(server, alarm) && server.alarmStatus(alarm) == AlarmEnabled {
+					alarms = append(alarms, alarm)
+				}
+			}
+			if len(alarms) == 0 {
+				continue
+			}
+			alarm := alarms[r.Intn(len(alarms))]
+			triggerNoise(proc, a, r, rule, server, alarm)
+
+			for _, c := range rule.Correlated {
+				if c.When != alarm || !hasAlarm(server, c.Alarm) || r.Float64() >= c.Probability {
+					continue
+				}
+				delay := 0.0
+				if c.Delay != nil {
+					delay = c.Delay.Sample(r)
+				}
+				correlated := c.Alarm
+				proc.Process(func(follow simgo.Process) {
+					follow.Wait(follow.Timeout(delay))
+					triggerNoise(follow, a, r, rule, server, correlated)
+				})
+			}
+		}
+	}
+}
+
+// triggerNoise trigger the alarm of the server, clearing it after the
+// duration of the rule unless something else raised it again meanwhile
+func triggerNoise(proc simgo.Process, a *Architecture, r *rand.Rand, rule *NoiseRule, server MonitoredServer, alarm string) {
+	duration := rule.Duration
+	if duration == nil {
+		duration = Exponential(5)
+	}
+	d := duration.Sample(r)
+
+	servers, alarms := []MonitoredServer{server}, []string{alarm}
+	trigger := a.raiseEnabledAlarms(servers, alarms, "")
+	proc.Process(func(clear simgo.Process) {
+		clear.Wait(clear.Timeout(d))
+		a.clearAlarms(trigger, servers, alarms)
+	})
+}
+
+func buildNoise(a *Architecture, noise []*Noise, fileName string) error {
+	for _, n := range noise {
+		monkey, err := n.Monkey(a)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", fileName, n.line, err)
+		}
+		a.AddMonkey(monkey)
+	}
+	return nil
+}
+
+// AddNoise add the noise generator to the architecture. It panics if the noise is not valid.
+func (a *Architecture) AddNoise(n *Noise) {
+	monkey, err := n.Monkey(a)
+	if err != nil {
+		panic(err)
+	}
+	a.AddMonkey(monkey)
+}
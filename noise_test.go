@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fschuetz04/simgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// simulateNoise run the noise for the time given, checking the alarms of all the servers each minute
+func simulateNoise(t *testing.T, a *Architecture, n *Noise, until float64) {
+	monkey, err := n.Monkey(a)
+	assert.NoError(t, err)
+
+	sim := simgo.Simulation{}
+	sim.Process(monkey)
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			for _, s := range a.GetAllServers() {
+				s.CheckAlarms(proc.Now())
+			}
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(until)
+}
+
+// countProblems return the number of problem events of each server
+func countProblems(mon *fakeMonSys) map[string]int {
+	count := map[string]int{}
+	for _, e := range mon.Events {
+		if e.State == ProblemState {
+			count[e.Server]++
+		}
+	}
+	return count
+}
+
+// TestNoiseRate checks that the noise is generated at the rate of the rule,
+// only in the servers of the selected type
+func TestNoiseRate(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	db1 := a.NewDatabase("db1")
+	a.NewBackend("backend1", db1)
+	a.NewBackend("backend2", db1)
+
+	n := &Noise{Rules: []*NoiseRule{{
+		Types:    []string{"backend"},
+		Alarms:   []string{"CPU"},
+		Rate:     2,
+		Duration: Constant(1),
+	}}}
+	simulateNoise(t, &a, n, 100*60)
+
+	count := countProblems(mon)
+	assert.InDelta(t, 200, count["backend1"], 40)
+	assert.InDelta(t, 200, count["backend2"], 40)
+	assert.Zero(t, count["db1"])
+	for _, e := range mon.Events {
+		assert.Equal(t, "CPU", e.Alarm)
+		assert.Equal(t, "noise", e.Incident)
+	}
+	assert.Empty(t, a.Incidents)
+}
+
+// TestNoiseSeasonality checks that there is no noise in the hours with a zero multiplier
+func TestNoiseSeasonality(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	a.NewServer("srv1")
+
+	daily := make([]float64, 24)
+	daily[1] = 1
+	n := &Noise{
+		Rules:       []*NoiseRule{{Rate: 10, Duration: Constant(1)}},
+		Seasonality: &Seasonality{Daily: daily, Weekly: []float64{1, 0, 1, 1, 1, 1, 1}},
+	}
+	// Two days, noise only in the hour 1 of the first one
+	simulateNoise(t, &a, n, 2*24*60)
+
+	assert.NotEmpty(t, mon.Events)
+	for _, e := range mon.Events {
+		assert.True(t, e.Time >= 60 && e.Time <= 122, "event at %v", e.Time)
+	}
+}
+
+// TestCorrelatedNoise checks that the correlated alarms follow the noise in the same server
+func TestCorrelatedNoise(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	a.NewServer("srv1")
+	a.NewServer("srv2")
+
+	n := &Noise{Rules: []*NoiseRule{{
+		Servers:    []string{"srv1"},
+		Alarms:     []string{"CPU"},
+		Rate:       1,
+		Duration:   Constant(2),
+		Correlated: []*CorrelatedNoise{{When: "CPU", Alarm: "Memory", Probability: 1, Delay: Constant(5)}},
+	}}}
+	simulateNoise(t, &a, n, 10*60)
+
+	cpu, memory := []float64{}, []float64{}
+	for _, e := range mon.Events {
+		assert.Equal(t, "srv1", e.Server)
+		if e.State != ProblemState {
+			continue
+		}
+		if e.Alarm == "CPU" {
+			cpu = append(cpu, e.Time)
+		} else {
+			memory = append(memory, e.Time)
+		}
+	}
+	assert.NotEmpty(t, cpu)
+	if assert.Len(t, memory, len(cpu)) {
+		for i := range cpu {
+			assert.Equal(t, cpu[i]+5, memory[i])
+		}
+	}
+}
+
+// TestNoiseBurst checks that each arrival triggers several alarms
+func TestNoiseBurst(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	for _, name := range []string{"srv1", "srv2", "srv3"} {
+		a.NewServer(name)
+	}
+
+	n := &Noise{Rules: []*NoiseRule{{
+		Alarms:   []string{"Ping"},
+		Rate:     0.1,
+		Burst:    Constant(3),
+		Duration: Constant(1),
+	}}}
+	simulateNoise(t, &a, n, 100*60)
+
+	// All the alarms of a burst are triggered at the same time
+	times := map[float64]int{}
+	for _, e := range mon.Events {
+		if e.State == ProblemState {
+			times[e.Time]++
+		}
+	}
+	assert.NotEmpty(t, times)
+	for _, n := range times {
+		assert.Equal(t, 3, n)
+	}
+}
+
+// TestNoiseDuringFault checks that the noise doesn't relabel nor clear the
+// alarms raised by a fault
+func TestNoiseDuringFault(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	db1 := a.NewDatabase("db1")
+	a.raiseAlarms([]MonitoredServer{db1}, []string{"DBEngine"}, "db1-down-0")
+
+	n := &Noise{Rules: []*NoiseRule{{
+		Alarms:   []string{"DBEngine"},
+		Rate:     10,
+		Duration: Constant(1),
+	}}}
+	simulateNoise(t, &a, n, 60)
+
+	if assert.Len(t, mon.Events, 1) {
+		assert.Equal(t, ProblemState, mon.Events[0].State)
+		assert.Equal(t, "db1-down-0", mon.Events[0].Incident)
+	}
+	assert.Equal(t, AlarmACK, db1.DBEngineAlarm)
+}
+
+func TestNoiseErrors(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+	a.NewServer("srv1")
+
+	topology := `servers:
+  - name: srv1
+noise:
+  - name: resources
+    rules:
+      - types: [server]
+        rate: 2
+        correlated:
+          - when: CPU
+            alarm: Memory
+            probability: 0.5
+  - name: seasonal
+    seasonality:
+      daily: [1, 2]
+    rules:
+      - rate: 1
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:12: noise "seasonal": daily seasonality should have 24 values, not 2`)
+
+	_, err = (&Noise{Name: "empty"}).Monkey(&a)
+	assert.EqualError(t, err, `noise "empty" without rules`)
+	_, err = (&Noise{Name: "norate", Rules: []*NoiseRule{{}}}).Monkey(&a)
+	assert.EqualError(t, err, `noise "norate": noise rule without rate`)
+}
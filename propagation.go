@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Propagation is how the failures of a dependency reach a client: only some
+// of the failures are noticed by the client, and after a delay, like the
+// timeout of a connection pool.
+type Propagation struct {
+	// Probability that the client notices each failure of the dependency
+	Probability float64
+	// Delay since the client sees the dependency down until it raises the
+	// alarm. Immediate if nil.
+	Delay *Distribution
+	// Rand is the random generator used to decide if a failure is noticed and its delay
+	Rand *rand.Rand
+}
+
+// SetPropagation set how the failures of the dependency (its name or its
+// type) reach the server. By default they are noticed in the next check.
+func (s *Server) SetPropagation(dependency string, p *Propagation) {
+	if s.Propagations == nil {
+		s.Propagations = make(map[string]*Propagation)
+	}
+	s.Propagations[dependency] = p
+}
+
+// propagation return the rule for the dependency, by name or by type, or nil if it has none
+func (s *Server) propagation(dependency Service) *Propagation {
+	if p, ok := s.Propagations[dependency.GetName()]; ok {
+		return p
+	}
+	return s.Propagations[dependency.GetType()]
+}
+
+// noticeDown returns true if the server has noticed that the dependency is
+// not available at time t. Each failure of the dependency is noticed, or
+// not, following its propagation rule.
+func (s *Server) noticeDown(dependency Service, t float64) bool {
+	p := s.propagation(dependency)
+	if p == nil {
+		return !dependency.Available()
+	}
+
+	if dependency.Available() {
+		delete(s.noticed, dependency.GetName())
+		return false
+	}
+
+	if s.noticed == nil {
+		s.noticed = make(map[string]float64)
+	}
+	noticed, ok := s.noticed[dependency.GetName()]
+	if !ok {
+		// New failure of the dependency
+		noticed = math.Inf(1)
+		if p.Rand.Float64() < p.Probability {
+			noticed = t
+			if p.Delay != nil {
+				noticed += p.Delay.Sample(p.Rand)
+			}
+		}
+		s.noticed[dependency.GetName()] = noticed
+	}
+	return t >= noticed
+}
+
+// noticeDown returns true if the client has noticed that the dependency is not
+// available, for any kind of client
+func noticeDown(client MonitoredServer, dependency Service, t float64) bool {
+	if c, ok := client.(interface {
+		noticeDown(Service, float64) bool
+	}); ok {
+		return c.noticeDown(dependency, t)
+	}
+	return !dependency.Available()
+}
+
+// SetPropagation set how the failures of the dependency reach the client.
+// Client and dependency are names or types of servers, so a rule could apply
+// to several edges, like "backend" and "db" for all the backends and their
+// databases. probability is the probability that each failure is noticed,
+// after the delay. Return an error if no server has that name or type.
+func (a *Architecture) SetPropagation(client, dependency string, probability float64, delay *Distribution) error {
+	if probability < 0 || probability > 1 {
+		return fmt.Errorf("invalid propagation probability %v, it should be between 0 and 1", probability)
+	}
+
+	p := &Propagation{Probability: probability, Delay: delay, Rand: a.Rand()}
+	found := false
+	for _, server := range a.GetAllServers() {
+		s, ok := server.(ArchitectureServer)
+		if !ok || (s.GetName() != client && s.GetType() != client) {
+			continue
+		}
+		server.SetPropagation(dependency, p)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("propagation references unknown server %q", client)
+	}
+	return nil
+}
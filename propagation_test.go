@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDelayedPropagation checks that the backend notices the failure of the
+// database after the delay, and the recovery immediately
+func TestDelayedPropagation(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := a.NewDatabase("db1")
+	backend1 := a.NewBackend("backend1", db1)
+	assert.NoError(t, a.SetPropagation("backend1", "db", 1, Constant(3)))
+
+	db1.SetAlarm("DBEngine", AlarmTriggered)
+	for minute := 0.0; minute < 6; minute++ {
+		if minute == 5 {
+			db1.SetAlarm("DBEngine", AlarmEnabled)
+		}
+		db1.CheckAlarms(minute)
+		backend1.CheckAlarms(minute)
+	}
+
+	assert.Equal(t, []string{"0,db1,DBEngine", "3,backend1,DBConnection"}, mon.Alarms)
+	assert.Equal(t, "backend1", mon.Events[len(mon.Events)-1].Server)
+	assert.Equal(t, ResolvedState, mon.Events[len(mon.Events)-1].State)
+}
+
+// TestProbabilisticPropagation checks that only some of the clients notice
+// each failure of the dependency
+func TestProbabilisticPropagation(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon, Seed: 1}
+	db1 := a.NewDatabase("db1")
+	for i := 0; i < 100; i++ {
+		a.NewBackend(fmt.Sprintf("backend%d", i), db1)
+	}
+	assert.NoError(t, a.SetPropagation("backend", "db1", 0.7, nil))
+
+	noticed := func() int {
+		n := 0
+		for _, b := range a.Backends {
+			b.CheckAlarms(0)
+			if b.DBConnectionAlarm != AlarmEnabled {
+				n++
+			}
+		}
+		return n
+	}
+
+	db1.SetAlarm("Ping", AlarmTriggered)
+	first := noticed()
+	assert.InDelta(t, 70, first, 15)
+	// The decision is kept while the failure lasts
+	assert.Equal(t, first, noticed())
+
+	// Each failure is decided again
+	db1.SetAlarm("Ping", AlarmEnabled)
+	assert.Equal(t, 0, noticed())
+	db1.SetAlarm("Ping", AlarmTriggered)
+	assert.InDelta(t, 70, noticed(), 15)
+}
+
+func TestDNSDelayedPropagation(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := a.NewServer("srv1")
+	dns1 := a.NewDNS("dns1")
+	dns1.AddClient(srv1)
+	assert.NoError(t, a.SetPropagation("server", "dns", 1, Constant(2)))
+
+	dns1.SetAlarm("Proc", AlarmTriggered)
+	for minute := 0.0; minute < 4; minute++ {
+		dns1.CheckAlarms(minute)
+		srv1.CheckAlarms(minute)
+	}
+	assert.Equal(t, []string{"0,dns1,Proc", "2,srv1,DNS"}, mon.Alarms)
+}
+
+func TestTopologyPropagation(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `databases:
+  - name: db1
+backends:
+  - name: backend
+    count: 2
+    database: db1
+propagations:
+  - client: backend
+    dependency: db
+    probability: 0.7
+    delay: {dist: uniform, min: 0, max: 3}
+  - client: backend1
+    dependency: db1
+  - client: frontend
+    dependency: backend
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:14: propagation references unknown server "frontend"`)
+
+	assert.Equal(t, 0.7, a.Backends[0].Propagations["db"].Probability)
+	assert.Equal(t, 1.0, a.Backends[1].Propagations["db1"].Probability)
+	assert.Nil(t, a.Backends[1].Propagations["db1"].Delay)
+}
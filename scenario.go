@@ -0,0 +1,508 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/fschuetz04/simgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Kind of random distributions that could be used in the faults
+const (
+	ConstantDistribution    = "constant"
+	UniformDistribution     = "uniform"
+	ExponentialDistribution = "exponential"
+	NormalDistribution      = "normal"
+)
+
+// Distribution generate random values (durations in minutes) for the faults.
+// In YAML it could be written as a number (constant value) or as a map:
+//
+//	{dist: uniform, min: 100, max: 500}
+//	{dist: exponential, mean: 30}
+//	{dist: normal, mean: 10, stddev: 2}
+type Distribution struct {
+	Dist   string  `yaml:"dist"`
+	Value  float64 `yaml:"value"`
+	Min    float64 `yaml:"min"`
+	Max    float64 `yaml:"max"`
+	Mean   float64 `yaml:"mean"`
+	StdDev float64 `yaml:"stddev"`
+}
+
+// Constant return a distribution that always return v
+func Constant(v float64) *Distribution {
+	return &Distribution{Dist: ConstantDistribution, Value: v}
+}
+
+// Uniform return a distribution with values in [min, max)
+func Uniform(min, max float64) *Distribution {
+	return &Distribution{Dist: UniformDistribution, Min: min, Max: max}
+}
+
+// Exponential return a distribution with the given mean
+func Exponential(mean float64) *Distribution {
+	return &Distribution{Dist: ExponentialDistribution, Mean: mean}
+}
+
+// Normal return a normal distribution. Negative values are returned as 0.
+func Normal(mean, stddev float64) *Distribution {
+	return &Distribution{Dist: NormalDistribution, Mean: mean, StdDev: stddev}
+}
+
+// UnmarshalYAML allow to write constant distributions as plain numbers
+func (d *Distribution) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		d.Dist = ConstantDistribution
+		return value.Decode(&d.Value)
+	}
+
+	type plain Distribution
+	if err := value.Decode((*plain)(d)); err != nil {
+		return err
+	}
+	return d.validate()
+}
+
+func (d *Distribution) validate() error {
+	switch d.Dist {
+	case ConstantDistribution, ExponentialDistribution, NormalDistribution:
+	case UniformDistribution:
+		if d.Max < d.Min {
+			return fmt.Errorf("uniform distribution with max (%v) lower than min (%v)", d.Max, d.Min)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", d.Dist)
+	}
+	return nil
+}
+
+// Sample return a random value of the distribution. It never returns negative values.
+func (d *Distribution) Sample(r *rand.Rand) float64 {
+	var v float64
+	switch d.Dist {
+	case UniformDistribution:
+		v = d.Min + r.Float64()*(d.Max-d.Min)
+	case ExponentialDistribution:
+		v = r.ExpFloat64() * d.Mean
+	case NormalDistribution:
+		v = d.Mean + r.NormFloat64()*d.StdDev
+	default:
+		v = d.Value
+	}
+	return math.Max(v, 0)
+}
+
+// How the targets of a fault are affected in each repetition
+const (
+	// PickAll trigger all the alarms in all the targets
+	PickAll = "all"
+	// PickOne trigger one random alarm in one random target
+	PickOne = "one"
+)
+
+// Fault describes a periodic sabotage of some servers of the architecture.
+// Each repetition triggers the alarms in the targets and, if Duration is
+// defined, enable them again after that time.
+//
+// The times are in minutes:
+//
+//	start      period
+//	|---------|---------|---------|
+//	  trigger  duration  clear
+type Fault struct {
+	Name string `yaml:"name"`
+	// Target is a shortcut to define only one target
+	Target  string   `yaml:"target"`
+	Targets []string `yaml:"targets"`
+	// Alarm is a shortcut to define only one alarm
+	Alarm  string   `yaml:"alarm"`
+	Alarms []string `yaml:"alarms"`
+	// Pick is PickAll (default) or PickOne
+	Pick string `yaml:"pick"`
+	// Start is the time of the first repetition. Default 0.
+	Start *Distribution `yaml:"start"`
+	// Duration is the time the alarms stay triggered. If nil the alarms are not cleared.
+	// It should be lower than Period, or the clear of one repetition will clear
+	// the alarms of the next one.
+	Duration *Distribution `yaml:"duration"`
+	// Period is the time between the start of each repetition. If nil the fault only happens once.
+	Period *Distribution `yaml:"period"`
+	// Repetitions is the maximum number of repetitions. 0 means no limit.
+	Repetitions int `yaml:"repetitions"`
+	// Noise faults do not generate incidents, their events are labeled as NoiseIncident
+	Noise bool `yaml:"noise"`
+	// Severity of the alarms when they are triggered. By default the base
+	// severity of each alarm.
+	Severity Severity `yaml:"severity"`
+	// Escalation are the changes of the severity while the alarms are triggered
+	Escalation []*Escalation `yaml:"escalation"`
+	// Exhaustion trigger the alarms gradually, consuming a resource. Duration
+	// is then the time the resource stays exhausted.
+	Exhaustion *Exhaustion `yaml:"exhaustion"`
+
+	line int
+}
+
+func (f *Fault) UnmarshalYAML(value *yaml.Node) error {
+	type plain Fault
+	f.line = value.Line
+	return value.Decode((*plain)(f))
+}
+
+func (f *Fault) targets() []string {
+	if f.Target != "" {
+		return append([]string{f.Target}, f.Targets...)
+	}
+	return f.Targets
+}
+
+func (f *Fault) alarms() []string {
+	if f.Alarm != "" {
+		return append([]string{f.Alarm}, f.Alarms...)
+	}
+	return f.Alarms
+}
+
+// Monkey compile the fault into a simulation process for the given architecture.
+// Return an error if some target or alarm is unknown.
+func (f *Fault) Monkey(a *Architecture) (func(simgo.Process), error) {
+	alarms := f.alarms()
+	if len(alarms) == 0 {
+		return nil, fmt.Errorf("fault %q without alarms", f.Name)
+	}
+
+	targetNames := f.targets()
+	if len(targetNames) == 0 {
+		return nil, fmt.Errorf("fault %q without targets", f.Name)
+	}
+
+	targets := make([]MonitoredServer, len(targetNames))
+	for i, name := range targetNames {
+		server := a.GetServer(name)
+		if server == nil {
+			return nil, fmt.Errorf("fault %q references unknown server %q", f.Name, name)
+		}
+		for _, alarm := range alarms {
+			if !hasAlarm(server, alarm) {
+				return nil, fmt.Errorf("fault %q references unknown alarm %q in server %q", f.Name, alarm, name)
+			}
+		}
+		if f.Exhaustion != nil {
+			for _, alarm := range f.Exhaustion.Then {
+				if !hasAlarm(server, alarm) {
+					return nil, fmt.Errorf("fault %q references unknown alarm %q in server %q", f.Name, alarm, name)
+				}
+			}
+		}
+		targets[i] = server
+	}
+
+	if f.Exhaustion != nil {
+		if err := f.Exhaustion.validate(); err != nil {
+			return nil, fmt.Errorf("fault %q: %v", f.Name, err)
+		}
+	}
+
+	switch f.Pick {
+	case "", PickAll, PickOne:
+	default:
+		return nil, fmt.Errorf("fault %q with unknown pick %q", f.Name, f.Pick)
+	}
+
+	name := f.Name
+	if name == "" {
+		name = "fault"
+	}
+
+	r := a.Rand()
+
+	return func(proc simgo.Process) {
+		if f.Start != nil {
+			proc.Wait(proc.Timeout(f.Start.Sample(r)))
+		}
+
+		for i := 0; f.Repetitions == 0 || i < f.Repetitions; i++ {
+			next := proc.Now()
+			if f.Period != nil {
+				next += f.Period.Sample(r)
+			}
+
+			// Select which alarms of which servers are affected in this repetition
+			servers, alarmNames := targets, alarms
+			if f.Pick == PickOne {
+				servers = []MonitoredServer{targets[r.Intn(len(targets))]}
+				alarmNames = []string{alarms[r.Intn(len(alarms))]}
+			}
+
+			if f.Exhaustion != nil {
+				// The resource is consumed in other process
+				fill, duration := f.Exhaustion.Fill.Sample(r), -1.0
+				if f.Duration != nil {
+					duration = f.Duration.Sample(r)
+				}
+				proc.Process(f.exhaust(a, name, servers, alarmNames, fill, duration))
+			} else {
+				f.trigger(proc, a, r, name, servers, alarmNames)
+			}
+
+			if f.Period == nil {
+				return
+			}
+			proc.Wait(proc.Timeout(math.Max(next-proc.Now(), 0)))
+		}
+	}, nil
+}
+
+// trigger the alarms of one repetition of the fault, and clear them after
+// its duration
+func (f *Fault) trigger(proc simgo.Process, a *Architecture, r *rand.Rand, name string, servers []MonitoredServer, alarmNames []string) {
+	var trigger int
+	incident := ""
+	if f.Noise {
+		trigger = a.raiseEnabledAlarms(servers, alarmNames, incident)
+	} else {
+		incident = a.StartIncident(name, proc.Now(), servers, alarmNames)
+		trigger = a.raiseAlarms(servers, alarmNames, incident)
+	}
+	a.setSeverity(trigger, servers, alarmNames, f.Severity)
+
+	// Change the severity in other process while the alarms are
+	// triggered, until they are cleared
+	cleared := false
+	if len(f.Escalation) > 0 {
+		proc.Process(func(escalate simgo.Process) {
+			for _, step := range f.Escalation {
+				if step.After != nil {
+					escalate.Wait(escalate.Timeout(step.After.Sample(r)))
+				}
+				if cleared {
+					return
+				}
+				a.setSeverity(trigger, servers, alarmNames, step.Severity)
+			}
+		})
+	}
+
+	// Clear the alarms in other process, so the repetitions are not
+	// delayed by the duration
+	if f.Duration != nil {
+		duration := f.Duration.Sample(r)
+		proc.Process(func(clear simgo.Process) {
+			clear.Wait(clear.Timeout(duration))
+			cleared = true
+			a.clearAlarms(trigger, servers, alarmNames)
+			if !f.Noise {
+				a.EndIncident(incident, clear.Now())
+			}
+		})
+	}
+}
+
+// NoiseFault return a fault that each minute triggers one random alarm (CPU,
+// Memory, Disk or Ping) in one of the servers, clearing it after some minutes.
+// The events are labeled as noise.
+func NoiseFault(servers []*Server) *Fault {
+	targets := make([]string, len(servers))
+	for i, s := range servers {
+		targets[i] = s.Name
+	}
+
+	return &Fault{
+		Name:     "noise",
+		Targets:  targets,
+		Alarms:   []string{"CPU", "Memory", "Disk", "Ping"},
+		Pick:     PickOne,
+		Period:   Constant(1),
+		Duration: Exponential(5),
+		Noise:    true,
+	}
+}
+
+func setAlarms(servers []MonitoredServer, alarms []string, status AlarmStatus, incident string) {
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			server.SetAlarm(alarm, status)
+			server.SetIncident(alarm, incident)
+		}
+	}
+}
+
+// alarmKey identify an alarm of a server
+type alarmKey struct {
+	server MonitoredServer
+	alarm  string
+}
+
+// raise is a trigger holding an alarm, with the incident and the severity it set
+type raise struct {
+	trigger  int
+	incident string
+	severity Severity
+}
+
+// raiseAlarms trigger the alarms like setAlarms and return the ID of this
+// trigger. The alarms stay triggered until every trigger holding them is
+// cleared, so the end of a repetition of a fault doesn't clear an alarm
+// triggered again by a later repetition or by other fault. The last trigger
+// sets the incident and the severity of the alarm.
+func (a *Architecture) raiseAlarms(servers []MonitoredServer, alarms []string, incident string) int {
+	return a.raise(servers, alarms, incident, false)
+}
+
+// raiseEnabledAlarms is like raiseAlarms, but only for the alarms not
+// already triggered, so the noise doesn't take over the alarms of a fault
+func (a *Architecture) raiseEnabledAlarms(servers []MonitoredServer, alarms []string, incident string) int {
+	return a.raise(servers, alarms, incident, true)
+}
+
+func (a *Architecture) raise(servers []MonitoredServer, alarms []string, incident string, enabledOnly bool) int {
+	a.triggers++
+	if a.raisedBy == nil {
+		a.raisedBy = make(map[alarmKey][]raise)
+	}
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			if enabledOnly && server.alarmStatus(alarm) != AlarmEnabled {
+				continue
+			}
+			key := alarmKey{server, alarm}
+			a.raisedBy[key] = append([]raise{{trigger: a.triggers, incident: incident}}, a.raisedBy[key]...)
+			setAlarms([]MonitoredServer{server}, []string{alarm}, AlarmTriggered, incident)
+		}
+	}
+	return a.triggers
+}
+
+// setSeverity change the severity of the alarms raised by the trigger, while
+// it is the last trigger holding them
+func (a *Architecture) setSeverity(trigger int, servers []MonitoredServer, alarms []string, severity Severity) {
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			raises := a.raisedBy[alarmKey{server, alarm}]
+			for i := range raises {
+				if raises[i].trigger == trigger {
+					raises[i].severity = severity
+				}
+			}
+			if len(raises) > 0 && raises[0].trigger == trigger {
+				server.SetAlarmSeverity(alarm, severity)
+			}
+		}
+	}
+}
+
+// clearAlarms release the alarms held by the trigger. They are enabled,
+// restoring their severity, if no other trigger holds them. Otherwise they
+// are triggered again with the incident and severity of the previous one.
+func (a *Architecture) clearAlarms(trigger int, servers []MonitoredServer, alarms []string) {
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			key := alarmKey{server, alarm}
+			raises := a.raisedBy[key]
+			held := -1
+			for i, r := range raises {
+				if r.trigger == trigger {
+					held = i
+				}
+			}
+			if held < 0 {
+				continue
+			}
+			raises = append(raises[:held], raises[held+1:]...)
+			if len(raises) == 0 {
+				delete(a.raisedBy, key)
+				setAlarms([]MonitoredServer{server}, []string{alarm}, AlarmEnabled, "")
+				server.SetAlarmSeverity(alarm, NoSeverity)
+				continue
+			}
+			a.raisedBy[key] = raises
+			if held == 0 {
+				setAlarms([]MonitoredServer{server}, []string{alarm}, AlarmTriggered, raises[0].incident)
+				server.SetAlarmSeverity(alarm, raises[0].severity)
+			}
+		}
+	}
+}
+
+// setSeverity change the current severity of the alarms in the servers
+func setSeverity(servers []MonitoredServer, alarms []string, severity Severity) {
+	for _, server := range servers {
+		for _, alarm := range alarms {
+			server.SetAlarmSeverity(alarm, severity)
+		}
+	}
+}
+
+// hasAlarm return true if the server has an alarm with that name
+func hasAlarm(server MonitoredServer, alarm string) bool {
+	s, ok := server.(ArchitectureServer)
+	if !ok {
+		return false
+	}
+	for _, a := range s.GetAlarms() {
+		if a == alarm {
+			return true
+		}
+	}
+	return false
+}
+
+// Scenario is a list of faults that could be applied to any architecture with
+// the servers referenced by the faults.
+type Scenario struct {
+	Faults []*Fault `yaml:"faults"`
+	// Noise generate alarms not related to the faults
+	Noise []*Noise `yaml:"noise"`
+
+	// file is the name of the file the scenario was read from, used in errors
+	file string
+}
+
+// LoadScenario read a scenario file (YAML or JSON) and add its faults to the architecture
+func LoadScenario(fileName string, a *Architecture) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := ParseScenario(f, fileName)
+	if err != nil {
+		return err
+	}
+
+	return s.Build(a)
+}
+
+// ParseScenario decode a scenario from r. fileName is only used in error messages.
+func ParseScenario(r io.Reader, fileName string) (*Scenario, error) {
+	s := &Scenario{file: fileName}
+	if err := yaml.NewDecoder(r).Decode(s); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return s, nil
+}
+
+// Build add the faults and the noise of the scenario as monkeys of the architecture
+func (s *Scenario) Build(a *Architecture) error {
+	if err := buildFaults(a, s.Faults, s.file); err != nil {
+		return err
+	}
+	return buildNoise(a, s.Noise, s.file)
+}
+
+func buildFaults(a *Architecture, faults []*Fault, fileName string) error {
+	for _, f := range faults {
+		monkey, err := f.Monkey(a)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", fileName, f.line, err)
+		}
+		a.AddMonkey(monkey)
+	}
+	return nil
+}
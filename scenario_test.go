@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fschuetz04/simgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFaultSchedule checks that a periodic fault triggers and clears the alarm
+// at the expected times
+func TestFaultSchedule(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	a.AddDB(db1)
+
+	monkey, err := (&Fault{
+		Target:      "db1",
+		Alarm:       "DBEngine",
+		Start:       Constant(10),
+		Duration:    Constant(5),
+		Period:      Constant(20),
+		Repetitions: 2,
+	}).Monkey(&a)
+	assert.NoError(t, err)
+
+	sim := simgo.Simulation{}
+	sim.Process(monkey)
+
+	// Sample the status of the alarm each minute
+	status := []AlarmStatus{}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			status = append(status, db1.DBEngineAlarm)
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(60)
+
+	for minute, s := range status {
+		triggered := (minute >= 10 && minute < 15) || (minute >= 30 && minute < 35)
+		if triggered {
+			assert.Equal(t, AlarmTriggered, s, "minute %d", minute)
+		} else {
+			assert.Equal(t, AlarmEnabled, s, "minute %d", minute)
+		}
+	}
+}
+
+// TestOverlappingRepetitions checks that the end of a repetition doesn't
+// clear the alarm triggered again by the next one, and that the alarm
+// triggered again while its problem is open doesn't report a new problem
+func TestOverlappingRepetitions(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	a.AddDB(db1)
+
+	monkey, err := (&Fault{
+		Target:      "db1",
+		Alarm:       "DBEngine",
+		Duration:    Constant(5),
+		Period:      Constant(3),
+		Repetitions: 2,
+	}).Monkey(&a)
+	assert.NoError(t, err)
+
+	sim := simgo.Simulation{}
+	sim.Process(monkey)
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			db1.CheckAlarms(proc.Now())
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(20)
+
+	assert.Equal(t, []string{"0,db1,DBEngine"}, mon.Alarms)
+	if assert.Len(t, mon.Events, 3) {
+		// The problem is updated with the incident of the second repetition
+		assert.Equal(t, UpdatedState, mon.Events[1].State)
+		assert.Equal(t, "fault-1", mon.Events[1].Incident)
+		assert.Equal(t, ResolvedState, mon.Events[2].State)
+		assert.Equal(t, 8.5, mon.Events[2].Time)
+	}
+}
+
+// TestOverlappingFaults checks that an alarm stays triggered, with the
+// incident of the fault still holding it, when other fault clears it first
+func TestOverlappingFaults(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	a.AddDB(db1)
+
+	sim := simgo.Simulation{}
+	for _, f := range []*Fault{
+		{Name: "long", Target: "db1", Alarm: "DBEngine", Duration: Constant(20)},
+		{Name: "short", Target: "db1", Alarm: "DBEngine", Start: Constant(5), Duration: Constant(5), Severity: SeverityWarning},
+	} {
+		monkey, err := f.Monkey(&a)
+		assert.NoError(t, err)
+		sim.Process(monkey)
+	}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			db1.CheckAlarms(proc.Now())
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(30)
+
+	assert.Equal(t, []string{
+		"0.5,db1,DBEngine,problem,critical",
+		"5.5,db1,DBEngine,updated,warning",
+		"10.5,db1,DBEngine,updated,critical",
+		"20.5,db1,DBEngine,resolved,critical",
+	}, eventLines(mon))
+	incidents := []string{}
+	for _, e := range mon.Events {
+		incidents = append(incidents, e.Incident)
+	}
+	assert.Equal(t, []string{"long-0", "short-0", "long-0", "long-0"}, incidents)
+}
+
+// TestNoiseFaultDuringFault checks that a noise fault doesn't take over nor
+// clear the alarms raised by other fault
+func TestNoiseFaultDuringFault(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	a.AddDB(db1)
+
+	sim := simgo.Simulation{}
+	for _, f := range []*Fault{
+		{Name: "db1-down", Target: "db1", Alarm: "DBEngine", Duration: Constant(10)},
+		{Name: "noise", Target: "db1", Alarm: "DBEngine", Start: Constant(1), Period: Constant(1), Repetitions: 5, Duration: Constant(2), Noise: true},
+	} {
+		monkey, err := f.Monkey(&a)
+		assert.NoError(t, err)
+		sim.Process(monkey)
+	}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(0.5))
+			db1.CheckAlarms(proc.Now())
+			proc.Wait(proc.Timeout(0.5))
+		}
+	})
+	sim.RunUntil(20)
+
+	assert.Equal(t, []string{"0.5,db1,DBEngine,problem,critical", "10.5,db1,DBEngine,resolved,critical"}, eventLines(mon))
+	assert.Equal(t, "db1-down-0", mon.Events[1].Incident)
+}
+
+func TestScenarioUnknownTarget(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+	a.AddDB(&Database{Server: Server{Name: "db1"}})
+
+	scenario := `faults:
+  - name: ok
+    target: db1
+    alarm: DBEngine
+  - name: bad
+    target: db2
+    alarm: Ping
+`
+	s, err := ParseScenario(strings.NewReader(scenario), "scenario.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, s.Build(&a), `scenario.yaml:5: fault "bad" references unknown server "db2"`)
+}
+
+func TestScenarioUnknownAlarm(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+	a.AddServer(&Server{Name: "srv1"})
+
+	scenario := `faults:
+  - name: bad
+    target: srv1
+    alarm: DBEngine
+`
+	s, err := ParseScenario(strings.NewReader(scenario), "scenario.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, s.Build(&a), `scenario.yaml:2: fault "bad" references unknown alarm "DBEngine" in server "srv1"`)
+}
+
+func TestDistributionYAML(t *testing.T) {
+	scenario := `faults:
+  - target: srv1
+    alarm: CPU
+    start: 10
+    duration: {dist: uniform, min: 1, max: 2}
+    period: {dist: exponential, mean: 30}
+`
+	s, err := ParseScenario(strings.NewReader(scenario), "scenario.yaml")
+	assert.NoError(t, err)
+
+	f := s.Faults[0]
+	assert.Equal(t, Constant(10), f.Start)
+	assert.Equal(t, Uniform(1, 2), f.Duration)
+	assert.Equal(t, Exponential(30), f.Period)
+
+	_, err = ParseScenario(strings.NewReader(`faults: [{start: {dist: gamma}}]`), "scenario.yaml")
+	assert.Error(t, err)
+}
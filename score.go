@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScoredEvent is a problem event of the events file, with the cluster
+// assigned by the correlator. Times are in seconds, like in the events file.
+type ScoredEvent struct {
+	Time     float64
+	Server   string
+	Alarm    string
+	EventID  int
+	Incident string
+	// Cluster assigned by the correlator. Empty if the event was not grouped.
+	Cluster string
+	// RootCause is true if the correlator marked the event as the root cause of its cluster
+	RootCause bool
+}
+
+// Score is the evaluation of a correlation result against the ground truth
+type Score struct {
+	// Events is the number of problem events evaluated
+	Events int `json:"events"`
+	// Incidents is the number of incidents with events
+	Incidents int `json:"incidents"`
+	// Clusters is the number of clusters found by the correlator
+	Clusters int `json:"clusters"`
+
+	// Precision, Recall and F1 of the pairs of events grouped together
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	// ARI is the adjusted Rand index between the incidents and the clusters
+	ARI float64 `json:"ari"`
+
+	// RootCauseHitRate is the fraction of incidents whose cluster has the
+	// injected server and alarm as root cause
+	RootCauseHitRate float64 `json:"root_cause_hit_rate"`
+
+	// Grouped is the number of incidents with at least two events in the same cluster
+	Grouped int `json:"grouped"`
+	// MeanTimeToGroup and MaxTimeToGroup are the seconds from the start of
+	// the incidents until two of their events are in the same cluster
+	MeanTimeToGroup float64 `json:"mean_time_to_group"`
+	MaxTimeToGroup  float64 `json:"max_time_to_group"`
+}
+
+// csvColumns return the position of each column of the header, checking
+// that the required ones exist
+func csvColumns(header []string, required ...string) (map[string]int, error) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return columns, nil
+}
+
+// ReadScoredEvents read the problem events of an events CSV file. Resolved
+// events are ignored, since the correlators group the problems.
+func ReadScoredEvents(r io.Reader) ([]*ScoredEvent, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty events file")
+	}
+
+	c, err := csvColumns(records[0], "time", "server", "alarm", "eventid", "incident")
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*ScoredEvent{}
+	for line, record := range records[1:] {
+		if state, ok := c["state"]; ok && record[state] != string(ProblemState) {
+			continue
+		}
+
+		t, err := strconv.ParseFloat(record[c["time"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid time %q", line+2, record[c["time"]])
+		}
+		id, err := strconv.Atoi(record[c["eventid"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid eventid %q", line+2, record[c["eventid"]])
+		}
+
+		events = append(events, &ScoredEvent{
+			Time:     t,
+			Server:   record[c["server"]],
+			Alarm:    record[c["alarm"]],
+			EventID:  id,
+			Incident: record[c["incident"]],
+		})
+	}
+	return events, nil
+}
+
+// ReadClusters read the clusters of a correlator and assign them to the events.
+// The file is a CSV with the columns "eventid" and "cluster". The eventid is
+// the same for all the events of an alarm of a server, so an optional "time"
+// column (in seconds) assign the cluster to only one of them. An optional
+// "root_cause" column (true/false) mark the root cause of the cluster.
+func ReadClusters(r io.Reader, events []*ScoredEvent) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("empty clusters file")
+	}
+
+	c, err := csvColumns(records[0], "eventid", "cluster")
+	if err != nil {
+		return err
+	}
+	timeColumn, withTime := c["time"]
+	rootColumn, withRoot := c["root_cause"]
+
+	byID := make(map[int][]*ScoredEvent)
+	for _, e := range events {
+		byID[e.EventID] = append(byID[e.EventID], e)
+	}
+
+	for line, record := range records[1:] {
+		id, err := strconv.Atoi(record[c["eventid"]])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid eventid %q", line+2, record[c["eventid"]])
+		}
+
+		rootCause := false
+		if withRoot && record[rootColumn] != "" {
+			if rootCause, err = strconv.ParseBool(record[rootColumn]); err != nil {
+				return fmt.Errorf("line %d: invalid root_cause %q", line+2, record[rootColumn])
+			}
+		}
+
+		matched := false
+		for _, e := range byID[id] {
+			if withTime && record[timeColumn] != "" {
+				t, err := strconv.ParseFloat(record[timeColumn], 64)
+				if err != nil {
+					return fmt.Errorf("line %d: invalid time %q", line+2, record[timeColumn])
+				}
+				if t != e.Time {
+					continue
+				}
+			}
+			e.Cluster = record[c["cluster"]]
+			e.RootCause = rootCause
+			matched = true
+		}
+		if !matched {
+			return fmt.Errorf("line %d: unknown event %q", line+2, strings.Join(record, ","))
+		}
+	}
+	return nil
+}
+
+// pairs is the number of pairs of n elements
+func pairs(n int) float64 {
+	return float64(n) * float64(n-1) / 2
+}
+
+// ratio return a/b, or 1 if there is nothing to compare
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 1
+	}
+	return a / b
+}
+
+// ComputeScore compare the clusters of the events with the incidents that
+// caused them. Noise events, and events without cluster, are each one in its
+// own group.
+func ComputeScore(events []*ScoredEvent, incidents []*Incident) Score {
+	score := Score{Events: len(events)}
+
+	// Labels of the ground truth and of the correlator for each event
+	truth := make([]string, len(events))
+	predicted := make([]string, len(events))
+	clusters := make(map[string]bool)
+	for i, e := range events {
+		truth[i] = e.Incident
+		if e.Incident == NoiseIncident || e.Incident == "" {
+			truth[i] = fmt.Sprintf("%s#%d", NoiseIncident, i)
+		}
+		predicted[i] = e.Cluster
+		if e.Cluster == "" {
+			predicted[i] = fmt.Sprintf("#%d", i)
+		} else {
+			clusters[e.Cluster] = true
+		}
+	}
+	score.Clusters = len(clusters)
+
+	// Pair counting from the contingency table
+	contingency := make(map[[2]string]int)
+	truthSize := make(map[string]int)
+	predictedSize := make(map[string]int)
+	for i := range events {
+		contingency[[2]string{truth[i], predicted[i]}]++
+		truthSize[truth[i]]++
+		predictedSize[predicted[i]]++
+	}
+
+	var together, truthPairs, predictedPairs float64
+	for _, n := range contingency {
+		together += pairs(n)
+	}
+	for _, n := range truthSize {
+		truthPairs += pairs(n)
+	}
+	for _, n := range predictedSize {
+		predictedPairs += pairs(n)
+	}
+
+	score.Precision = ratio(together, predictedPairs)
+	score.Recall = ratio(together, truthPairs)
+	if score.Precision+score.Recall > 0 {
+		score.F1 = 2 * score.Precision * score.Recall / (score.Precision + score.Recall)
+	}
+
+	expected := 0.0
+	if len(events) > 1 {
+		expected = truthPairs * predictedPairs / pairs(len(events))
+	}
+	score.ARI = ratio(together-expected, (truthPairs+predictedPairs)/2-expected)
+
+	// Root causes and start of each incident
+	rootCauses := make(map[string]map[string]bool)
+	starts := make(map[string]float64)
+	for _, i := range incidents {
+		if rootCauses[i.ID] == nil {
+			rootCauses[i.ID] = make(map[string]bool)
+			starts[i.ID] = i.Start
+		}
+		rootCauses[i.ID][i.Server+","+i.Alarm] = true
+		starts[i.ID] = math.Min(starts[i.ID], i.Start)
+	}
+
+	// Events of each incident and of each cluster, sorted by time
+	byIncident := make(map[string][]*ScoredEvent)
+	byCluster := make(map[string][]*ScoredEvent)
+	ids := []string{}
+	for _, e := range events {
+		if e.Incident == NoiseIncident || e.Incident == "" {
+			continue
+		}
+		if _, ok := byIncident[e.Incident]; !ok {
+			ids = append(ids, e.Incident)
+		}
+		byIncident[e.Incident] = append(byIncident[e.Incident], e)
+	}
+	for _, e := range events {
+		if e.Cluster != "" {
+			byCluster[e.Cluster] = append(byCluster[e.Cluster], e)
+		}
+	}
+	for _, list := range byCluster {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	}
+	sort.Strings(ids)
+	score.Incidents = len(ids)
+
+	hits := 0
+	totalTimeToGroup := 0.0
+	for _, id := range ids {
+		cluster := majorityCluster(byIncident[id])
+		if cluster == "" {
+			continue
+		}
+
+		// The root cause of the cluster is the one marked by the correlator
+		// or its first event
+		root := byCluster[cluster][0]
+		for _, e := range byCluster[cluster] {
+			if e.RootCause {
+				root = e
+				break
+			}
+		}
+		if rootCauses[id][root.Server+","+root.Alarm] {
+			hits++
+		}
+
+		// The incident is grouped when the second of its events joins the cluster
+		n := 0
+		for _, e := range byCluster[cluster] {
+			if e.Incident != id {
+				continue
+			}
+			n++
+			if n == 2 {
+				start, ok := starts[id]
+				if !ok {
+					start = byIncident[id][0].Time
+				}
+				t := e.Time - start
+				score.Grouped++
+				totalTimeToGroup += t
+				score.MaxTimeToGroup = math.Max(score.MaxTimeToGroup, t)
+				break
+			}
+		}
+	}
+
+	score.RootCauseHitRate = ratio(float64(hits), float64(score.Incidents))
+	if score.Grouped > 0 {
+		score.MeanTimeToGroup = totalTimeToGroup / float64(score.Grouped)
+	}
+
+	return score
+}
+
+// majorityCluster return the cluster with more events of the list, the one of
+// the first event in case of tie. Empty if none of the events has cluster.
+func majorityCluster(events []*ScoredEvent) string {
+	count := make(map[string]int)
+	best := ""
+	for _, e := range events {
+		if e.Cluster == "" {
+			continue
+		}
+		count[e.Cluster]++
+		if best == "" || count[e.Cluster] > count[best] {
+			best = e.Cluster
+		}
+	}
+	return best
+}
+
+// Print write the score in a human readable format
+func (s Score) Print(w io.Writer) {
+	fmt.Fprintf(w, "Events:              %d\n", s.Events)
+	fmt.Fprintf(w, "Incidents:           %d\n", s.Incidents)
+	fmt.Fprintf(w, "Clusters:            %d\n", s.Clusters)
+	fmt.Fprintf(w, "Pairwise precision:  %.4f\n", s.Precision)
+	fmt.Fprintf(w, "Pairwise recall:     %.4f\n", s.Recall)
+	fmt.Fprintf(w, "Pairwise F1:         %.4f\n", s.F1)
+	fmt.Fprintf(w, "Adjusted Rand index: %.4f\n", s.ARI)
+	fmt.Fprintf(w, "Root cause hit rate: %.4f\n", s.RootCauseHitRate)
+	fmt.Fprintf(w, "Grouped incidents:   %d\n", s.Grouped)
+	fmt.Fprintf(w, "Mean time to group:  %.0fs\n", s.MeanTimeToGroup)
+	fmt.Fprintf(w, "Max time to group:   %.0fs\n", s.MaxTimeToGroup)
+}
+
+// PrintReport write the scores of several correlators as a table
+func PrintReport(w io.Writer, report []CorrelatorScore) {
+	fmt.Fprintf(w, "%-12s %8s %8s %8s %8s %8s %10s %10s\n",
+		"correlator", "clusters", "prec", "recall", "F1", "ARI", "root-cause", "time-group")
+	for _, r := range report {
+		fmt.Fprintf(w, "%-12s %8d %8.4f %8.4f %8.4f %8.4f %10.4f %9.0fs\n",
+			r.Correlator, r.Clusters, r.Precision, r.Recall, r.F1, r.ARI, r.RootCauseHitRate, r.MeanTimeToGroup)
+	}
+}
+
+// readCSVFile open the file and read it with the function
+func readCSVFile(fileName string, read func(io.Reader) error) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := read(f); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	return nil
+}
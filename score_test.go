@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const scoreEvents = CSVHeader + `60,db1,Ping,201,db1-down-0,problem,critical
+60,backend1,DBConnection,302,db1-down-0,problem,critical
+90,srv1,CPU,101,noise,problem,critical
+120,frontend1,BackendConnection,403,db1-down-0,problem,critical
+180,db1,Ping,201,db1-down-0,resolved,critical
+`
+
+const scoreIncidents = `incident,fault,server,alarm,start,end
+db1-down-0,db1-down,db1,Ping,60,180
+`
+
+func scoreOf(t *testing.T, clusters string) Score {
+	events, err := ReadScoredEvents(strings.NewReader(scoreEvents))
+	assert.NoError(t, err)
+	assert.Len(t, events, 4)
+
+	assert.NoError(t, ReadClusters(strings.NewReader(clusters), events))
+
+	incidents, err := ReadIncidents(strings.NewReader(scoreIncidents))
+	assert.NoError(t, err)
+	return ComputeScore(events, incidents)
+}
+
+func TestScorePerfectClusters(t *testing.T) {
+	// The noise event is not grouped
+	score := scoreOf(t, "eventid,cluster\n201,A\n302,A\n403,A\n")
+
+	assert.Equal(t, 4, score.Events)
+	assert.Equal(t, 1, score.Incidents)
+	assert.Equal(t, 1, score.Clusters)
+	assert.Equal(t, 1.0, score.Precision)
+	assert.Equal(t, 1.0, score.Recall)
+	assert.Equal(t, 1.0, score.ARI)
+	assert.Equal(t, 1.0, score.RootCauseHitRate)
+	assert.Equal(t, 1, score.Grouped)
+	assert.Equal(t, 0.0, score.MeanTimeToGroup)
+}
+
+func TestScoreOneCluster(t *testing.T) {
+	// Everything grouped together, with the wrong root cause
+	score := scoreOf(t, "eventid,cluster,root_cause\n201,A,\n302,A,true\n403,A,\n101,A,\n")
+
+	assert.Equal(t, 0.5, score.Precision)
+	assert.Equal(t, 1.0, score.Recall)
+	assert.InDelta(t, 2.0/3, score.F1, 1e-9)
+	assert.Equal(t, 0.0, score.ARI)
+	assert.Equal(t, 0.0, score.RootCauseHitRate)
+}
+
+func TestScoreTimeToGroup(t *testing.T) {
+	// The first two events are grouped when the third one arrives
+	score := scoreOf(t, "eventid,cluster\n201,A\n302,B\n403,A\n")
+
+	assert.Equal(t, 1.0, score.Precision)
+	assert.InDelta(t, 1.0/3, score.Recall, 1e-9)
+	assert.Equal(t, 1, score.Grouped)
+	assert.Equal(t, 60.0, score.MeanTimeToGroup)
+	assert.Equal(t, 60.0, score.MaxTimeToGroup)
+}
+
+func TestReadClustersErrors(t *testing.T) {
+	events, err := ReadScoredEvents(strings.NewReader(scoreEvents))
+	assert.NoError(t, err)
+
+	assert.Error(t, ReadClusters(strings.NewReader("eventid\n201\n"), events))
+	assert.Error(t, ReadClusters(strings.NewReader("eventid,cluster\n999,A\n"), events))
+	// The time selects one of the occurrences of the event
+	assert.Error(t, ReadClusters(strings.NewReader("eventid,cluster,time\n201,A,30\n"), events))
+	assert.NoError(t, ReadClusters(strings.NewReader("eventid,cluster,time\n201,A,60\n"), events))
+}
@@ -16,9 +16,37 @@ type Server struct {
 	DiskAlarm   AlarmStatus
 	PingAlarm   AlarmStatus
 	DNSAlarm    AlarmStatus
+	// Aliases rename some alarms of this server in the events and the graph,
+	// like two backends reporting the same problem with different names.
+	// The key is the name of the alarm and the value the name exposed.
+	Aliases map[string]string
+	// Severities is the severity of each alarm when it is triggered. Critical by default.
+	Severities map[string]Severity
+	// UnavailableSeverity is the minimum severity of the alarms that make the
+	// server unavailable. Critical by default.
+	UnavailableSeverity Severity
+	// Propagations are the rules of how the failures of the dependencies
+	// reach this server, by name or type of the dependency
+	Propagations map[string]*Propagation
 
 	// mon connection to the monitoring system
 	mon MonitorSystem
+
+	// incidents store, for each alarm, the incident that triggered it
+	incidents map[string]string
+	// open store the alarms with a reported problem not yet resolved, with
+	// the incident of the problem
+	open map[string]string
+	// severity is the current severity of the alarms, if it is not the base one
+	severity map[string]Severity
+	// reported is the severity reported for the open alarms
+	reported map[string]Severity
+	// noticed store, for each dependency down with a propagation rule, when
+	// its failure is noticed. Infinite if it is not noticed.
+	noticed map[string]float64
+	// removed is true if the server has been removed from the architecture
+	// and should not be monitored anymore
+	removed bool
 }
 
 type MonitoredServer interface {
@@ -26,12 +54,38 @@ type MonitoredServer interface {
 	CheckAlarms(float64)
 	// SetAlarm using the string to identify the alarm, set the alarm to the given status
 	SetAlarm(string, AlarmStatus)
+	// alarmStatus return the status of the alarm
+	alarmStatus(string) AlarmStatus
+	// SetIncident store the incident that caused the alarm. Empty to clear it.
+	SetIncident(string, string)
+	// AlarmName return the name exposed for the alarm
+	AlarmName(string) string
+	// SetAlarmSeverity change the current severity of the alarm. NoSeverity restores the base one.
+	SetAlarmSeverity(string, Severity)
+	// SetPropagation set how the failures of a dependency reach the server
+	SetPropagation(string, *Propagation)
+	// Removed returns true if the server has been removed from the architecture
+	Removed() bool
 }
 
 type ArchitectureServer interface {
 	GetName() string
 	GetType() string
 	GetAlarms() []string
+	// AlarmName return the name exposed for the alarm
+	AlarmName(string) string
+	// BaseSeverity return the severity of the alarm when it is triggered
+	BaseSeverity(string) Severity
+}
+
+// Service is a server other servers could depend on
+type Service interface {
+	GetName() string
+	GetType() string
+	// Available returns true if the service could be used by its clients
+	Available() bool
+	// Cause returns the incident that made the service unavailable
+	Cause() string
 }
 
 func NewServer(name string, mon MonitorSystem) *Server {
@@ -59,50 +113,142 @@ func (s *Server) GetType() string {
 	return string(ServerNode)
 }
 
+// SetAlias expose the alarm with other name in the events and the graph
+func (s *Server) SetAlias(alarm string, alias string) {
+	if s.Aliases == nil {
+		s.Aliases = make(map[string]string)
+	}
+	s.Aliases[alarm] = alias
+}
+
+// AlarmName return the alias of the alarm, or its name if it has no alias
+func (s *Server) AlarmName(alarm string) string {
+	if alias, ok := s.Aliases[alarm]; ok {
+		return alias
+	}
+	return alarm
+}
+
 // Run check the alarms of each server each interval
-func Run(proc simgo.Process, m MonitoredServer) {
+func Run(proc simgo.Process, m MonitoredServer, r *rand.Rand) {
 	// Desalign the time of checking for each server
-	proc.Wait(proc.Timeout(float64(rand.Intn(AlarmCheckInterval))))
+	proc.Wait(proc.Timeout(float64(r.Intn(AlarmCheckInterval))))
 
-	for {
+	// Stop monitoring the server when it is removed from the architecture
+	for !m.Removed() {
 		m.CheckAlarms(proc.Now())
 		proc.Wait(proc.Timeout(AlarmCheckInterval))
 		// Execution jitter
-		proc.Wait(proc.Timeout(AlarmCheckInterval * rand.Float64() * IntervalJitter))
+		proc.Wait(proc.Timeout(AlarmCheckInterval * r.Float64() * IntervalJitter))
 	}
 }
 
-// CheckAlarms if the server has alarms and print a message for each triggered alarm
+// CheckAlarms if the server has alarms and print a message for each triggered
+// or resolved alarm
 func (s *Server) CheckAlarms(t float64) {
-	if s.CPUAlarm == AlarmTriggered {
-		s.CPUAlarm = AlarmACK
-		s.mon.handleAlarm(s.Name, "CPU", t)
+	s.checkAlarm("CPU", &s.CPUAlarm, t)
+	s.checkAlarm("Memory", &s.MemoryAlarm, t)
+	s.checkAlarm("Disk", &s.DiskAlarm, t)
+	s.checkAlarm("Ping", &s.PingAlarm, t)
+	s.checkAlarm("DNS", &s.DNSAlarm, t)
+}
+
+// checkAlarm report the changes of the alarm since the last check: a problem
+// if it has been triggered, an update if its severity has changed, and
+// resolved if it is enabled again after a problem was reported.
+func (s *Server) checkAlarm(alarm string, status *AlarmStatus, t float64) {
+	switch *status {
+	case AlarmTriggered:
+		*status = AlarmACK
+		incident, open := s.open[alarm]
+		if !open {
+			s.report(alarm, ProblemState, t)
+			return
+		}
+		// Triggered again while its problem is still open, like two
+		// overlapping faults: the open problem continues, updated with the
+		// new incident
+		if incident != s.incident(alarm) {
+			s.open[alarm] = s.incident(alarm)
+			s.report(alarm, UpdatedState, t)
+			return
+		}
+		fallthrough
+	case AlarmACK:
+		if _, open := s.open[alarm]; open && s.reported[alarm] != s.AlarmSeverity(alarm) {
+			s.report(alarm, UpdatedState, t)
+		}
+	case AlarmEnabled:
+		if _, open := s.open[alarm]; open {
+			s.report(alarm, ResolvedState, t)
+		}
 	}
+}
 
-	if s.MemoryAlarm == AlarmTriggered {
-		s.MemoryAlarm = AlarmACK
-		s.mon.handleAlarm(s.Name, "Memory", t)
+// report send the event of the alarm to the monitoring system.
+// Resolved and updated events carry the incident of the problem they resolve
+// or update. Resolved events carry also its last severity.
+func (s *Server) report(alarm string, state EventState, t float64) {
+	if s.open == nil {
+		s.open = make(map[string]string)
+		s.reported = make(map[string]Severity)
 	}
 
-	if s.DiskAlarm == AlarmTriggered {
-		s.DiskAlarm = AlarmACK
-		s.mon.handleAlarm(s.Name, "Disk", t)
+	incident := s.incident(alarm)
+	severity := s.AlarmSeverity(alarm)
+	switch state {
+	case ResolvedState:
+		incident = s.open[alarm]
+		severity = s.reported[alarm]
+		delete(s.open, alarm)
+		delete(s.reported, alarm)
+	case UpdatedState:
+		incident = s.open[alarm]
+		s.reported[alarm] = severity
+	default:
+		s.open[alarm] = incident
+		s.reported[alarm] = severity
 	}
 
-	if s.PingAlarm == AlarmTriggered {
-		s.PingAlarm = AlarmACK
-		s.mon.handleAlarm(s.Name, "Ping", t)
+	s.mon.handleAlarm(Event{
+		Time:     t,
+		Server:   s.Name,
+		Alarm:    s.AlarmName(alarm),
+		Incident: incident,
+		State:    state,
+		Severity: severity,
+	})
+}
+
+// SetIncident store the incident that caused the alarm. Empty to clear it.
+func (s *Server) SetIncident(alarm string, incident string) {
+	if s.incidents == nil {
+		s.incidents = make(map[string]string)
 	}
+	s.incidents[alarm] = incident
+}
 
-	if s.DNSAlarm == AlarmTriggered {
-		s.DNSAlarm = AlarmACK
-		s.mon.handleAlarm(s.Name, "DNS", t)
+// incident return the incident that caused the alarm or NoiseIncident if it is unknown
+func (s *Server) incident(alarm string) string {
+	if incident := s.incidents[alarm]; incident != "" {
+		return incident
 	}
+	return NoiseIncident
+}
+
+// Removed returns true if the server has been removed from the architecture
+func (s *Server) Removed() bool {
+	return s.removed
 }
 
 // Available returns true if the server is considered available
 func (s *Server) Available() bool {
-	return s.PingAlarm == AlarmEnabled
+	return !s.failed("Ping", s.PingAlarm)
+}
+
+// Cause returns the incident that made the server unavailable
+func (s *Server) Cause() string {
+	return s.incident("Ping")
 }
 
 func (s *Server) SetAlarm(alarm string, status AlarmStatus) {
@@ -121,3 +267,21 @@ func (s *Server) SetAlarm(alarm string, status AlarmStatus) {
 		panic(fmt.Sprintf("Unknown alarm: %s", alarm))
 	}
 }
+
+// alarmStatus return the status of one of the alarms of the server
+func (s *Server) alarmStatus(alarm string) AlarmStatus {
+	switch alarm {
+	case "CPU":
+		return s.CPUAlarm
+	case "Memory":
+		return s.MemoryAlarm
+	case "Disk":
+		return s.DiskAlarm
+	case "Ping":
+		return s.PingAlarm
+	case "DNS":
+		return s.DNSAlarm
+	default:
+		panic(fmt.Sprintf("Unknown alarm: %s", alarm))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a triggered alarm, like a disk at 85% (warning) or a dead disk
+// (critical). Alarms could escalate and de-escalate while they are triggered.
+type Severity int
+
+const (
+	// NoSeverity use the severity configured for the alarm in the server
+	NoSeverity Severity = iota
+	SeverityInfo
+	SeverityWarning
+	// SeverityCritical is the severity of the alarms without other severity
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	NoSeverity:       "",
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityCritical: "critical",
+}
+
+func (s Severity) String() string {
+	return severityNames[s]
+}
+
+// ParseSeverity return the severity with that name
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severityNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return NoSeverity, fmt.Errorf("unknown severity %q", name)
+}
+
+// UnmarshalYAML read the severity from its name
+func (s *Severity) UnmarshalYAML(value *yaml.Node) error {
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+	severity, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+	*s = severity
+	return nil
+}
+
+// Escalation is a change of the severity of the alarms of a fault while they
+// are triggered
+type Escalation struct {
+	// After is the time since the previous change, or since the alarms were triggered
+	After    *Distribution `yaml:"after"`
+	Severity Severity      `yaml:"severity"`
+}
+
+// SetSeverity set the severity of the alarm when it is triggered, unless
+// other severity is set by the fault that triggers it
+func (s *Server) SetSeverity(alarm string, severity Severity) {
+	if s.Severities == nil {
+		s.Severities = make(map[string]Severity)
+	}
+	s.Severities[alarm] = severity
+}
+
+// BaseSeverity return the severity configured for the alarm, critical by default
+func (s *Server) BaseSeverity(alarm string) Severity {
+	if severity := s.Severities[alarm]; severity != NoSeverity {
+		return severity
+	}
+	return SeverityCritical
+}
+
+// SetAlarmSeverity change the current severity of the alarm. If it is
+// triggered, the change is reported in the next check.
+// NoSeverity restores its base severity.
+func (s *Server) SetAlarmSeverity(alarm string, severity Severity) {
+	if s.severity == nil {
+		s.severity = make(map[string]Severity)
+	}
+	s.severity[alarm] = severity
+}
+
+// AlarmSeverity return the current severity of the alarm
+func (s *Server) AlarmSeverity(alarm string) Severity {
+	if severity := s.severity[alarm]; severity != NoSeverity {
+		return severity
+	}
+	return s.BaseSeverity(alarm)
+}
+
+// failed returns true if the alarm is not enabled and its severity makes the
+// server unavailable
+func (s *Server) failed(alarm string, status AlarmStatus) bool {
+	minimum := s.UnavailableSeverity
+	if minimum == NoSeverity {
+		minimum = SeverityCritical
+	}
+	return status != AlarmEnabled && s.AlarmSeverity(alarm) >= minimum
+}
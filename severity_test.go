@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fschuetz04/simgo"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAlarmEscalation checks that the changes of severity of a triggered alarm
+// are reported, and that the resolved event has its last severity
+func TestAlarmEscalation(t *testing.T) {
+	mon := &fakeMonSys{}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	srv1.SetSeverity("Disk", SeverityWarning)
+
+	srv1.SetAlarm("Disk", AlarmTriggered)
+	srv1.CheckAlarms(0)
+
+	// Nothing new while the severity does not change
+	srv1.CheckAlarms(1)
+
+	srv1.SetAlarmSeverity("Disk", SeverityCritical)
+	srv1.CheckAlarms(2)
+
+	srv1.SetAlarm("Disk", AlarmEnabled)
+	srv1.SetAlarmSeverity("Disk", NoSeverity)
+	srv1.CheckAlarms(3)
+
+	assert.Equal(t, []Event{
+		{Time: 0, Server: "srv1", Alarm: "Disk", Incident: NoiseIncident, State: ProblemState, Severity: SeverityWarning},
+		{Time: 2, Server: "srv1", Alarm: "Disk", Incident: NoiseIncident, State: UpdatedState, Severity: SeverityCritical},
+		{Time: 3, Server: "srv1", Alarm: "Disk", Incident: NoiseIncident, State: ResolvedState, Severity: SeverityCritical},
+	}, mon.Events)
+}
+
+// TestAvailableBySeverity checks that only the alarms with enough severity
+// make the servers unavailable
+func TestAvailableBySeverity(t *testing.T) {
+	mon := &fakeMonSys{}
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	backend1 := &Backend{Server: Server{Name: "backend1", mon: mon}, DBEngine: db1}
+
+	// A degraded database is still available
+	db1.SetAlarm("DBEngine", AlarmTriggered)
+	db1.SetAlarmSeverity("DBEngine", SeverityWarning)
+	assert.True(t, db1.Available())
+
+	db1.CheckAlarms(0)
+	backend1.CheckAlarms(0)
+	assert.Equal(t, []string{"0,db1,DBEngine"}, mon.Alarms)
+
+	// Unless the warnings are enough to consider it unavailable
+	db1.UnavailableSeverity = SeverityWarning
+	assert.False(t, db1.Available())
+
+	// Or the alarm escalates
+	db1.UnavailableSeverity = NoSeverity
+	db1.SetAlarmSeverity("DBEngine", SeverityCritical)
+	assert.False(t, db1.Available())
+
+	db1.CheckAlarms(1)
+	backend1.CheckAlarms(1)
+	assert.Equal(t, []string{"0,db1,DBEngine", "1,backend1,DBConnection"}, mon.Alarms)
+	assert.Equal(t, UpdatedState, mon.Events[1].State)
+}
+
+// TestFaultEscalation checks that the fault changes the severity of its alarms
+// until they are cleared
+func TestFaultEscalation(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	a.AddServer(srv1)
+
+	scenario := `faults:
+  - name: disk-full
+    target: srv1
+    alarm: Disk
+    start: 10
+    duration: 25
+    severity: info
+    escalation:
+      - {after: 10, severity: warning}
+      - {after: 10, severity: critical}
+      - {after: 10, severity: warning}
+`
+	s, err := ParseScenario(strings.NewReader(scenario), "scenario.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Build(&a))
+
+	sim := simgo.Simulation{}
+	for _, monkey := range a.Monkeys {
+		sim.Process(monkey)
+	}
+	sim.Process(func(proc simgo.Process) {
+		for {
+			proc.Wait(proc.Timeout(1))
+			srv1.CheckAlarms(proc.Now())
+		}
+	})
+	sim.RunUntil(60)
+
+	severities := []string{}
+	for _, e := range mon.Events {
+		severities = append(severities, string(e.State)+":"+e.Severity.String())
+	}
+	// The last de-escalation happens after the alarm is cleared
+	assert.Equal(t, []string{"problem:info", "updated:warning", "updated:critical", "resolved:critical"}, severities)
+	assert.Equal(t, SeverityCritical, srv1.AlarmSeverity("Disk"))
+}
+
+func TestSeverityYAML(t *testing.T) {
+	_, err := ParseScenario(strings.NewReader("faults:\n  - severity: bad\n"), "scenario.yaml")
+	assert.EqualError(t, err, `scenario.yaml: unknown severity "bad"`)
+}
+
+func TestSeverityGraphAttribute(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+	srv1 := &Server{Name: "srv1", mon: mon}
+	srv1.SetSeverity("CPU", SeverityWarning)
+	a.AddServer(srv1)
+
+	nodes := make(map[string]map[string]interface{})
+	for _, n := range a.CytoscapeJSON().Elements.Nodes {
+		nodes[n.Data["name"].(string)] = n.Data
+	}
+	assert.Equal(t, "warning", nodes["srv1-CPU"]["severity"])
+	assert.Equal(t, "critical", nodes["srv1-Ping"]["severity"])
+	assert.NotContains(t, nodes["srv1"], "severity")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// EventSink receive the events as they are generated by the monitoring system
+type EventSink interface {
+	// WriteEvent write an event with its id
+	WriteEvent(event Event, eventid int) error
+	// Close flush the pending events and close the output
+	Close() error
+}
+
+// eventSeconds return the time of the event in seconds, as it is written
+func eventSeconds(t float64) float64 {
+	return math.RoundToEven(t * 60)
+}
+
+// BufferedSink write the events to a buffer, flushing it to the output each
+// FlushEvery events, so only the last events are lost if the run panics
+type BufferedSink struct {
+	// FlushEvery is the number of events between flushes. If 0 the buffer is
+	// only flushed when full.
+	FlushEvery int
+
+	w       *bufio.Writer
+	closer  io.Closer
+	format  func(Event, int) ([]byte, error)
+	pending int
+}
+
+// NewBufferedSink create a sink writing to w the events formatted with format.
+// If w is an io.Closer it is closed with the sink.
+func NewBufferedSink(w io.Writer, format func(Event, int) ([]byte, error)) *BufferedSink {
+	s := &BufferedSink{
+		FlushEvery: 100,
+		w:          bufio.NewWriter(w),
+		format:     format,
+	}
+	if c, ok := w.(io.Closer); ok && w != os.Stdout && w != os.Stderr {
+		s.closer = c
+	}
+	return s
+}
+
+func (s *BufferedSink) WriteEvent(event Event, eventid int) error {
+	line, err := s.format(event, eventid)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(line); err != nil {
+		return err
+	}
+
+	s.pending++
+	if s.FlushEvery > 0 && s.pending >= s.FlushEvery {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush write the buffered events to the output
+func (s *BufferedSink) Flush() error {
+	s.pending = 0
+	return s.w.Flush()
+}
+
+// Close flush the events and close the output. It could be called several times.
+func (s *BufferedSink) Close() error {
+	err := s.Flush()
+	if s.closer != nil {
+		if cerr := s.closer.Close(); err == nil {
+			err = cerr
+		}
+		s.closer = nil
+	}
+	return err
+}
+
+// CSVHeader is the header of the events CSV file
+const CSVHeader = "time,server,alarm,eventid,incident,state,severity\n"
+
+// formatCSV format the event as a line of the events CSV file
+func formatCSV(event Event, eventid int) ([]byte, error) {
+	return []byte(fmt.Sprintf("%.0f,%s,%s,%v,%s,%s,%s\n", eventSeconds(event.Time), event.Server, event.Alarm,
+		eventid, event.Incident, event.State, event.Severity)), nil
+}
+
+// NewCSVSink create a sink writing the events to w in CSV format, with header
+func NewCSVSink(w io.Writer) (*BufferedSink, error) {
+	s := NewBufferedSink(w, formatCSV)
+	if _, err := s.w.WriteString(CSVHeader); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewCSVFileSink create a sink writing the events to a CSV file
+func NewCSVFileSink(fileName string) (*BufferedSink, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewCSVSink(f)
+}
+
+// jsonEvent is the format of an event in JSON lines
+type jsonEvent struct {
+	// Time in seconds, like in the CSV
+	Time     float64    `json:"time"`
+	Server   string     `json:"server"`
+	Alarm    string     `json:"alarm"`
+	EventID  int        `json:"eventid"`
+	Incident string     `json:"incident"`
+	State    EventState `json:"state"`
+	Severity string     `json:"severity"`
+}
+
+// formatJSONLine format the event as a JSON object in one line
+func formatJSONLine(event Event, eventid int) ([]byte, error) {
+	line, err := json.Marshal(jsonEvent{
+		Time:     eventSeconds(event.Time),
+		Server:   event.Server,
+		Alarm:    event.Alarm,
+		EventID:  eventid,
+		Incident: event.Incident,
+		State:    event.State,
+		Severity: event.Severity.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// NewJSONLinesSink create a sink writing to w each event as a JSON object per line
+func NewJSONLinesSink(w io.Writer) *BufferedSink {
+	return NewBufferedSink(w, formatJSONLine)
+}
+
+// NewJSONLinesFileSink create a sink writing the events to a JSON lines file
+func NewJSONLinesFileSink(fileName string) (*BufferedSink, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesSink(f), nil
+}
+
+// NewStdoutSink create a sink printing the events in CSV format, without
+// header, flushing each event
+func NewStdoutSink() *BufferedSink {
+	s := NewBufferedSink(os.Stdout, formatCSV)
+	s.FlushEvery = 1
+	return s
+}
+
+// MultiSink send each event to all its sinks
+type MultiSink []EventSink
+
+func (m MultiSink) WriteEvent(event Event, eventid int) error {
+	for _, s := range m {
+		if err := s.WriteEvent(event, eventid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close close all the sinks, returning the first error
+func (m MultiSink) Close() error {
+	var err error
+	for _, s := range m {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
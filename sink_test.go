@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := NewCSVSink(&buf)
+	assert.NoError(t, err)
+	s.FlushEvery = 2
+
+	assert.NoError(t, s.WriteEvent(Event{Time: 1, Server: "db1", Alarm: "Ping", Incident: "db1-down-1", State: ProblemState, Severity: SeverityCritical}, 204))
+	// Not flushed until FlushEvery events are written
+	assert.Equal(t, "", buf.String())
+
+	assert.NoError(t, s.WriteEvent(Event{Time: 2.5, Server: "db1", Alarm: "Ping", Incident: "db1-down-1", State: ResolvedState, Severity: SeverityCritical}, 204))
+	assert.Equal(t, CSVHeader+"60,db1,Ping,204,db1-down-1,problem,critical\n150,db1,Ping,204,db1-down-1,resolved,critical\n", buf.String())
+
+	assert.NoError(t, s.WriteEvent(Event{Time: 3, Server: "srv1", Alarm: "CPU", Incident: NoiseIncident, State: ProblemState, Severity: SeverityCritical}, 101))
+	assert.NoError(t, s.Close())
+	assert.Contains(t, buf.String(), "180,srv1,CPU,101,noise,problem,critical\n")
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewJSONLinesSink(&buf)
+
+	assert.NoError(t, s.WriteEvent(Event{Time: 1, Server: "db1", Alarm: "Ping", Incident: "db1-down-1", State: ProblemState, Severity: SeverityCritical}, 204))
+	assert.NoError(t, s.Close())
+	assert.Equal(t, `{"time":60,"server":"db1","alarm":"Ping","eventid":204,"incident":"db1-down-1","state":"problem","severity":"critical"}`+"\n", buf.String())
+}
+
+func TestMultiSink(t *testing.T) {
+	var csv, jsonl bytes.Buffer
+	csvSink, err := NewCSVSink(&csv)
+	assert.NoError(t, err)
+
+	mon := &PrinterMonitorSystem{Rand: (&Architecture{}).Rand()}
+	mon.Sink = MultiSink{csvSink, NewJSONLinesSink(&jsonl)}
+
+	db1 := &Database{Server: Server{Name: "db1", mon: mon}}
+	db1.PingAlarm = AlarmTriggered
+	db1.CheckAlarms(1)
+	assert.NoError(t, mon.Sink.Close())
+
+	id := mon.generateEventID("db1", "Ping")
+	assert.Equal(t, CSVHeader+fmt.Sprintf("60,db1,Ping,%d,noise,problem,critical\n", id), csv.String())
+	assert.Equal(t, fmt.Sprintf(`{"time":60,"server":"db1","alarm":"Ping","eventid":%d,"incident":"noise","state":"problem","severity":"critical"}`+"\n", id), jsonl.String())
+}
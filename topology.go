@@ -0,0 +1,644 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Topology is the declarative description of an Architecture.
+// It could be written in YAML or JSON (JSON is parsed as YAML), so datasets can
+// be authored without writing Go code.
+//
+// Example:
+//
+//	databases:
+//	  - name: db1
+//	backends:
+//	  - name: backendA
+//	    database: db1
+//	frontends:
+//	  - name: frontendA1
+//	    backend: backendA
+//	servers:
+//	  - name: noise
+//	    count: 5
+//	faults:
+//	  - target: db1
+//	    alarm: Ping
+//	    start: 60
+//	    duration: 5
+//	    period: 60
+type Topology struct {
+	Servers   []*TopologyServer   `yaml:"servers"`
+	Databases []*TopologyServer   `yaml:"databases"`
+	Backends  []*TopologyBackend  `yaml:"backends"`
+	Frontends []*TopologyFrontend `yaml:"frontends"`
+	// LoadBalancers is named "loadbalancers" in the file
+	LoadBalancers []*TopologyLoadBalancer `yaml:"loadbalancers"`
+	DNSs          []*TopologyDNS          `yaml:"dns"`
+	Clusters      []*TopologyCluster      `yaml:"clusters"`
+	// Kinds define new kinds of nodes used by the components
+	Kinds      []*ComponentKind     `yaml:"kinds"`
+	Components []*TopologyComponent `yaml:"components"`
+	// KubeNodes and Deployments are the Kubernetes nodes and workloads
+	KubeNodes   []*TopologyServer     `yaml:"kube_nodes"`
+	Deployments []*TopologyDeployment `yaml:"deployments"`
+	// Hypervisors are the hosts of the servers that run as virtual machines
+	Hypervisors []*TopologyHypervisor `yaml:"hypervisors"`
+	// Propagations are the rules of how the failures reach the clients
+	Propagations []*TopologyPropagation `yaml:"propagations"`
+	// Faults to inject in the servers of the topology
+	Faults []*Fault `yaml:"faults"`
+	// Noise generate alarms not related to the faults
+	Noise []*Noise `yaml:"noise"`
+
+	// file is the name of the file the topology was read from, used in errors
+	file string
+}
+
+// TopologyServer describes a server or a database.
+// If Count is greater than zero, Count servers are created with the name
+// used as prefix: noise0, noise1, ...
+type TopologyServer struct {
+	Name  string `yaml:"name"`
+	Count int    `yaml:"count"`
+
+	line int
+}
+
+// TopologyBackend describes a backend and the database it is connected to,
+// with its replicas and other dependencies.
+// If Transitive is true the backend is unavailable while the database is down.
+type TopologyBackend struct {
+	Name         string                       `yaml:"name"`
+	Count        int                          `yaml:"count"`
+	Database     string                       `yaml:"database"`
+	Replicas     []string                     `yaml:"replicas"`
+	Dependencies []*TopologyBackendDependency `yaml:"dependencies"`
+	Transitive   bool                         `yaml:"transitive"`
+
+	line int
+}
+
+// TopologyBackendDependency describes a service used by a backend, of any type
+type TopologyBackendDependency struct {
+	Service  string   `yaml:"service"`
+	Replicas []string `yaml:"replicas"`
+	Optional bool     `yaml:"optional"`
+}
+
+// TopologyFrontend describes a frontend and the backend it is connected to,
+// or the load balancer of a pool of backends.
+// If Transitive is true the frontend is unavailable while the backend is down.
+type TopologyFrontend struct {
+	Name         string `yaml:"name"`
+	Count        int    `yaml:"count"`
+	Backend      string `yaml:"backend"`
+	LoadBalancer string `yaml:"loadbalancer"`
+	Transitive   bool   `yaml:"transitive"`
+
+	line int
+}
+
+// TopologyLoadBalancer describes a load balancer and the frontends behind it,
+// or its pool of members of any type.
+type TopologyLoadBalancer struct {
+	Name      string   `yaml:"name"`
+	Count     int      `yaml:"count"`
+	Frontends []string `yaml:"frontends"`
+	Members   []string `yaml:"members"`
+	// MinMembers is the number of available members below which the pool is degraded
+	MinMembers int `yaml:"min_members"`
+
+	line int
+}
+
+// TopologyComponent describes a component of one of the kinds defined in the
+// topology, and the servers it depends on.
+type TopologyComponent struct {
+	Name      string   `yaml:"name"`
+	Count     int      `yaml:"count"`
+	Kind      string   `yaml:"kind"`
+	DependsOn []string `yaml:"depends_on"`
+
+	line int
+}
+
+// TopologyDeployment describes a Kubernetes deployment and the nodes where
+// its pods could run, all the nodes if empty.
+type TopologyDeployment struct {
+	Name            string   `yaml:"name"`
+	Replicas        int      `yaml:"replicas"`
+	Nodes           []string `yaml:"nodes"`
+	MinReady        int      `yaml:"min_ready"`
+	RescheduleDelay float64  `yaml:"reschedule_delay"`
+
+	line int
+}
+
+// TopologyHypervisor describes a hypervisor and its guests, servers of any
+// type. With Count, the guests are distributed between the hypervisors.
+type TopologyHypervisor struct {
+	Name              string   `yaml:"name"`
+	Count             int      `yaml:"count"`
+	Guests            []string `yaml:"guests"`
+	MigrationDuration float64  `yaml:"migration_duration"`
+
+	line int
+}
+
+// TopologyDNS describes a DNS server and its clients.
+// If AllClients is true every other server of the topology is a client.
+type TopologyDNS struct {
+	Name       string   `yaml:"name"`
+	Clients    []string `yaml:"clients"`
+	AllClients bool     `yaml:"all_clients"`
+
+	line int
+}
+
+// TopologyCluster describes a group of databases that should be linked between them.
+// With Quorum, it is a cluster of servers of any type with its own node and
+// alarms, available while Quorum members are available (the majority if 0).
+type TopologyCluster struct {
+	Name    string   `yaml:"name"`
+	Members []string `yaml:"members"`
+	Quorum  *int     `yaml:"quorum"`
+
+	line int
+}
+
+// TopologyPropagation describes how the failures of the dependency reach the
+// client. Both are names or types of servers.
+type TopologyPropagation struct {
+	Client     string `yaml:"client"`
+	Dependency string `yaml:"dependency"`
+	// Probability that each failure is noticed. 1 if it is not defined.
+	Probability *float64      `yaml:"probability"`
+	Delay       *Distribution `yaml:"delay"`
+
+	line int
+}
+
+// UnmarshalYAML store the line of each element to be able to report errors
+func (s *TopologyServer) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyServer
+	s.line = value.Line
+	return value.Decode((*plain)(s))
+}
+
+func (b *TopologyBackend) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyBackend
+	b.line = value.Line
+	return value.Decode((*plain)(b))
+}
+
+func (f *TopologyFrontend) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyFrontend
+	f.line = value.Line
+	return value.Decode((*plain)(f))
+}
+
+func (l *TopologyLoadBalancer) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyLoadBalancer
+	l.line = value.Line
+	return value.Decode((*plain)(l))
+}
+
+func (d *TopologyDeployment) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyDeployment
+	d.line = value.Line
+	return value.Decode((*plain)(d))
+}
+
+func (h *TopologyHypervisor) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyHypervisor
+	h.line = value.Line
+	return value.Decode((*plain)(h))
+}
+
+func (c *TopologyComponent) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyComponent
+	c.line = value.Line
+	return value.Decode((*plain)(c))
+}
+
+func (d *TopologyDNS) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyDNS
+	d.line = value.Line
+	return value.Decode((*plain)(d))
+}
+
+func (c *TopologyCluster) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyCluster
+	c.line = value.Line
+	return value.Decode((*plain)(c))
+}
+
+func (p *TopologyPropagation) UnmarshalYAML(value *yaml.Node) error {
+	type plain TopologyPropagation
+	p.line = value.Line
+	return value.Decode((*plain)(p))
+}
+
+// LoadTopology read a topology file (YAML or JSON) and add its servers to the architecture
+func LoadTopology(fileName string, a *Architecture) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t, err := ParseTopology(f, fileName)
+	if err != nil {
+		return err
+	}
+
+	return t.Build(a)
+}
+
+// ParseTopology decode a topology from r. fileName is only used in error messages.
+func ParseTopology(r io.Reader, fileName string) (*Topology, error) {
+	t := &Topology{file: fileName}
+	if err := yaml.NewDecoder(r).Decode(t); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return t, nil
+}
+
+// errorf return an error with the file and line where the problem is
+func (t *Topology) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", t.file, line, fmt.Sprintf(format, args...))
+}
+
+// names expand the name of an element with a count to the list of names
+func names(name string, count int) []string {
+	if count <= 0 {
+		return []string{name}
+	}
+	n := make([]string, count)
+	for i := 0; i < count; i++ {
+		n[i] = fmt.Sprintf("%s%d", name, i)
+	}
+	return n
+}
+
+// Build create the servers of the topology in the architecture.
+// References between servers are resolved by name, returning an error if some
+// of them is unknown.
+func (t *Topology) Build(a *Architecture) error {
+	// Lines where each server was defined, to detect duplicates
+	defined := make(map[string]int)
+	define := func(name string, line int) error {
+		if name == "" {
+			return t.errorf(line, "missing name")
+		}
+		if prev, ok := defined[name]; ok {
+			return t.errorf(line, "duplicated name %q, already defined at line %d", name, prev)
+		}
+		defined[name] = line
+		return nil
+	}
+
+	for _, s := range t.Servers {
+		for _, name := range names(s.Name, s.Count) {
+			if err := define(name, s.line); err != nil {
+				return err
+			}
+			a.NewServer(name)
+		}
+	}
+
+	dbs := make(map[string]*Database)
+	for _, d := range t.Databases {
+		for _, name := range names(d.Name, d.Count) {
+			if err := define(name, d.line); err != nil {
+				return err
+			}
+			dbs[name] = a.NewDatabase(name)
+		}
+	}
+
+	backends := make(map[string]*Backend)
+	backendDefs := make(map[*Backend]*TopologyBackend)
+	for _, b := range t.Backends {
+		db, ok := dbs[b.Database]
+		if !ok {
+			return t.errorf(b.line, "backend %q references unknown database %q", b.Name, b.Database)
+		}
+		replicas := make([]*Database, 0, len(b.Replicas))
+		for _, r := range b.Replicas {
+			replica, ok := dbs[r]
+			if !ok {
+				return t.errorf(b.line, "backend %q references unknown replica %q", b.Name, r)
+			}
+			replicas = append(replicas, replica)
+		}
+		for _, name := range names(b.Name, b.Count) {
+			if err := define(name, b.line); err != nil {
+				return err
+			}
+			backends[name] = a.NewBackend(name, db)
+			backends[name].Transitive = b.Transitive
+			for _, replica := range replicas {
+				backends[name].AddReplica(replica)
+			}
+			backendDefs[backends[name]] = b
+		}
+	}
+
+	// Load balancers are created before the frontends, that could be
+	// connected to them, but they are added to the architecture once their
+	// frontends are resolved. Their members are resolved at the end.
+	lbs := make(map[string]*LoadBalancer)
+	for _, l := range t.LoadBalancers {
+		for _, name := range names(l.Name, l.Count) {
+			if err := define(name, l.line); err != nil {
+				return err
+			}
+			lbs[name] = NewLoadBalancer(name, a.mon)
+			lbs[name].MinMembers = l.MinMembers
+		}
+	}
+
+	frontends := make(map[string]*Frontend)
+	for _, f := range t.Frontends {
+		for _, name := range names(f.Name, f.Count) {
+			if err := define(name, f.line); err != nil {
+				return err
+			}
+		}
+		if f.LoadBalancer != "" {
+			lb, ok := lbs[f.LoadBalancer]
+			if !ok {
+				return t.errorf(f.line, "frontend %q references unknown load balancer %q", f.Name, f.LoadBalancer)
+			}
+			for _, name := range names(f.Name, f.Count) {
+				frontends[name] = a.NewPoolFrontend(name, lb)
+				frontends[name].Transitive = f.Transitive
+			}
+			continue
+		}
+		backend, ok := backends[f.Backend]
+		if !ok {
+			return t.errorf(f.line, "frontend %q references unknown backend %q", f.Name, f.Backend)
+		}
+		for _, name := range names(f.Name, f.Count) {
+			frontends[name] = a.NewFrontend(name, backend)
+			frontends[name].Transitive = f.Transitive
+		}
+	}
+
+	lbDefs := make(map[*LoadBalancer]*TopologyLoadBalancer)
+	for _, l := range t.LoadBalancers {
+		members := make([]*Frontend, 0, len(l.Frontends))
+		for _, m := range l.Frontends {
+			frontend, ok := frontends[m]
+			if !ok {
+				return t.errorf(l.line, "load balancer %q references unknown frontend %q", l.Name, m)
+			}
+			members = append(members, frontend)
+		}
+		for _, name := range names(l.Name, l.Count) {
+			lbs[name].Frontends = append([]*Frontend{}, members...)
+			a.AddLoadBalancer(lbs[name])
+			lbDefs[lbs[name]] = l
+		}
+	}
+
+	nodes := make(map[string]*KubeNode)
+	for _, n := range t.KubeNodes {
+		for _, name := range names(n.Name, n.Count) {
+			if err := define(name, n.line); err != nil {
+				return err
+			}
+			nodes[name] = a.NewKubeNode(name)
+		}
+	}
+
+	for _, d := range t.Deployments {
+		deploymentNodes := a.KubeNodes
+		if len(d.Nodes) > 0 {
+			deploymentNodes = make([]*KubeNode, 0, len(d.Nodes))
+			for _, n := range d.Nodes {
+				node, ok := nodes[n]
+				if !ok {
+					return t.errorf(d.line, "deployment %q references unknown node %q", d.Name, n)
+				}
+				deploymentNodes = append(deploymentNodes, node)
+			}
+		}
+		if err := define(d.Name, d.line); err != nil {
+			return err
+		}
+		deployment := NewDeployment(d.Name, a.mon, d.Replicas, append([]*KubeNode{}, deploymentNodes...)...)
+		deployment.MinReady = d.MinReady
+		deployment.RescheduleDelay = d.RescheduleDelay
+		for _, pod := range deployment.Pods {
+			if err := define(pod.Name, d.line); err != nil {
+				return err
+			}
+		}
+		a.AddDeployment(deployment)
+	}
+
+	// Hypervisors are created before the DNS servers, that could have them as
+	// clients, but their guests are resolved at the end
+	hypervisors := make(map[*TopologyHypervisor][]*Hypervisor)
+	for _, h := range t.Hypervisors {
+		for _, name := range names(h.Name, h.Count) {
+			if err := define(name, h.line); err != nil {
+				return err
+			}
+			hypervisor := a.NewHypervisor(name)
+			hypervisor.MigrationDuration = h.MigrationDuration
+			hypervisors[h] = append(hypervisors[h], hypervisor)
+		}
+	}
+
+	kinds := make(map[string]*ComponentKind)
+	for _, k := range t.Kinds {
+		if err := k.validate(); err != nil {
+			return t.errorf(k.line, "%v", err)
+		}
+		if prev, ok := kinds[k.Name]; ok {
+			return t.errorf(k.line, "duplicated kind %q, already defined at line %d", k.Name, prev.line)
+		}
+		kinds[k.Name] = k
+	}
+
+	// Components are created before resolving the dependencies, so they
+	// could depend on other components
+	components := make(map[*Component]*TopologyComponent)
+	for _, c := range t.Components {
+		kind, ok := kinds[c.Kind]
+		if !ok {
+			return t.errorf(c.line, "component %q references unknown kind %q", c.Name, c.Kind)
+		}
+		for _, name := range names(c.Name, c.Count) {
+			if err := define(name, c.line); err != nil {
+				return err
+			}
+			components[a.NewComponent(name, kind)] = c
+		}
+	}
+
+	services := make(map[string]Service)
+	for _, s := range a.GetAllServers() {
+		services[s.GetName()] = s.(Service)
+	}
+	for _, component := range a.Components {
+		c, ok := components[component]
+		if !ok {
+			continue
+		}
+		for _, d := range c.DependsOn {
+			dependency, ok := services[d]
+			if !ok {
+				return t.errorf(c.line, "component %q references unknown dependency %q", c.Name, d)
+			}
+			component.Dependencies = append(component.Dependencies, dependency)
+		}
+	}
+
+	for _, backend := range a.Backends {
+		b, ok := backendDefs[backend]
+		if !ok {
+			continue
+		}
+		for _, d := range b.Dependencies {
+			dependencies := make([]Service, 0, 1+len(d.Replicas))
+			for _, name := range append([]string{d.Service}, d.Replicas...) {
+				service, ok := services[name]
+				if !ok {
+					return t.errorf(b.line, "backend %q references unknown dependency %q", b.Name, name)
+				}
+				dependencies = append(dependencies, service)
+			}
+			backend.AddDependency(dependencies[0], d.Optional, dependencies[1:]...)
+		}
+	}
+
+	for _, lb := range a.LoadBalancers {
+		l, ok := lbDefs[lb]
+		if !ok {
+			continue
+		}
+		for _, m := range l.Members {
+			member, ok := services[m]
+			if !ok {
+				return t.errorf(l.line, "load balancer %q references unknown member %q", l.Name, m)
+			}
+			lb.AddMember(member)
+		}
+	}
+
+	for _, c := range t.Clusters {
+		if len(c.Members) == 0 {
+			return t.errorf(c.line, "cluster %q without members", c.Name)
+		}
+		if c.Quorum != nil {
+			continue
+		}
+		members := make([]*Database, 0, len(c.Members))
+		for _, m := range c.Members {
+			db, ok := dbs[m]
+			if !ok {
+				return t.errorf(c.line, "cluster %q references unknown database %q", c.Name, m)
+			}
+			members = append(members, db)
+		}
+		a.NewClusterDB(members)
+	}
+
+	// DNS servers are created at the end, so "all_clients" could use every other server
+	servers := make(map[string]MonitoredServer)
+	for _, s := range a.GetAllServers() {
+		servers[s.GetName()] = s
+	}
+	for _, d := range t.DNSs {
+		if err := define(d.Name, d.line); err != nil {
+			return err
+		}
+		dns := a.NewDNS(d.Name)
+
+		if d.AllClients {
+			for _, s := range a.GetAllServers() {
+				if _, isDNS := s.(*DNS); !isDNS {
+					dns.AddClient(s)
+				}
+			}
+			continue
+		}
+
+		for _, c := range d.Clients {
+			client, ok := servers[c]
+			if !ok {
+				return t.errorf(d.line, "dns %q references unknown client %q", d.Name, c)
+			}
+			dns.AddClient(client)
+		}
+	}
+
+	// Clusters with quorum are created after the DNS servers, they are not clients
+	for _, c := range t.Clusters {
+		if c.Quorum == nil {
+			continue
+		}
+		if *c.Quorum < 0 || *c.Quorum > len(c.Members) {
+			return t.errorf(c.line, "cluster %q quorum %d should be between 0 and its %d members", c.Name, *c.Quorum, len(c.Members))
+		}
+		members := make([]Service, 0, len(c.Members))
+		for _, m := range c.Members {
+			member := a.GetServer(m)
+			if member == nil {
+				return t.errorf(c.line, "cluster %q references unknown member %q", c.Name, m)
+			}
+			members = append(members, member.(Service))
+		}
+		if err := define(c.Name, c.line); err != nil {
+			return err
+		}
+		a.NewCluster(c.Name, *c.Quorum, members...)
+	}
+
+	// Each guest runs on the hypervisor of its definition with less guests
+	hosts := make(map[string]string)
+	for _, h := range t.Hypervisors {
+		for _, g := range h.Guests {
+			guest := a.GetServer(g)
+			if guest == nil {
+				return t.errorf(h.line, "hypervisor %q references unknown guest %q", h.Name, g)
+			}
+			if host, ok := hosts[g]; ok {
+				return t.errorf(h.line, "guest %q already runs on hypervisor %q", g, host)
+			}
+			var host *Hypervisor
+			for _, hypervisor := range hypervisors[h] {
+				if host == nil || len(hypervisor.Guests) < len(host.Guests) {
+					host = hypervisor
+				}
+			}
+			host.AddGuest(guest)
+			hosts[g] = host.Name
+		}
+	}
+
+	for _, p := range t.Propagations {
+		probability := 1.0
+		if p.Probability != nil {
+			probability = *p.Probability
+		}
+		if err := a.SetPropagation(p.Client, p.Dependency, probability, p.Delay); err != nil {
+			return t.errorf(p.line, "%v", err)
+		}
+	}
+
+	if err := buildFaults(a, t.Faults, t.file); err != nil {
+		return err
+	}
+	return buildNoise(a, t.Noise, t.file)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterDataset("MuchoRuidoPocasNueces", "Mucho ruido en 200 nodos y caídas de servicio muy poco frecuentes. Los backends de una misma DB llaman distinto a sus alarmas", MuchoRuidoPocasNueces)
+}
+
+// MuchoRuidoPocasNueces genera mucho ruido y tira los servicios muy poco.
+// La correlación temporal apenas aporta, porque en cualquier ventana de tiempo
+// hay muchas alarmas de ruido.
+// Además los backends conectados a la misma DB generan alarmas con nombres
+// distintos cuando pierden la conexión, así que tampoco se puede agrupar por
+// el nombre de la alarma. Y no todos se enteran de cada caída, ni a la vez.
+func MuchoRuidoPocasNueces(a *Architecture) {
+	// One database with four backends, each one from a different team that
+	// names the alarms in its own way
+	db1 := a.NewDatabase("db1")
+
+	backendA := a.NewBackend("backendA", db1)
+	backendB := a.NewBackend("backendB", db1)
+	backendB.SetAlias("DBConnection", "SQLPoolExhausted")
+	backendC := a.NewBackend("backendC", db1)
+	backendC.SetAlias("DBConnection", "JDBCTimeout")
+	backendD := a.NewBackend("backendD", db1)
+	backendD.SetAlias("DBConnection", "ConnectionRefused")
+
+	a.NewFrontend("frontendA1", backendA)
+	frontendB1 := a.NewFrontend("frontendB1", backendB)
+	frontendB1.SetAlias("BackendConnection", "HTTP502")
+	frontendC1 := a.NewFrontend("frontendC1", backendC)
+	frontendC1.SetAlias("BackendConnection", "UpstreamTimeout")
+	a.NewFrontend("frontendD1", backendD)
+
+	// One app with frontend, backend and database
+	db2 := a.NewDatabase("db2")
+	backendE := a.NewBackend("backendE", db2)
+	backendE.SetAlias("DBConnection", "DatabaseUnreachable")
+	a.NewFrontend("frontendE1", backendE)
+
+	// The backends notice the failures of db1 when the connection pool times
+	// out, after 0-3', and only 70% of them notice each failure
+	for _, backend := range []*Backend{backendA, backendB, backendC, backendD} {
+		if err := a.SetPropagation(backend.Name, db1.Name, 0.7, Uniform(0, 3)); err != nil {
+			panic(err)
+		}
+	}
+
+	// A lot of servers as noise
+	noiseServers := []*Server{}
+	for i := 0; i < 200; i++ {
+		noiseServers = append(noiseServers, a.NewServer("noise"+fmt.Sprintf("%d", i)))
+	}
+
+	// Disconnect db1 once every two or three days, for 10'
+	a.AddFault(&Fault{
+		Name:     "db1-down",
+		Target:   db1.Name,
+		Alarm:    "Ping",
+		Start:    Uniform(12*60, 48*60),
+		Duration: Constant(10),
+		Period:   Uniform(48*60, 72*60),
+	})
+
+	// Disconnect db2 about once every four days, for 15'
+	a.AddFault(&Fault{
+		Name:     "db2-down",
+		Target:   db2.Name,
+		Alarm:    "Ping",
+		Start:    Uniform(24*60, 72*60),
+		Duration: Constant(15),
+		Period:   Exponential(4 * 24 * 60),
+	})
+
+	// Generate a lot of alarm noise: about ten alarms each minute in the noise servers
+	noise := NoiseFault(noiseServers)
+	noise.Period = Exponential(0.1)
+	a.AddFault(noise)
+
+	// Also noise in the resources of the servers of the services, that are
+	// not related with the outages
+	serviceNoise := NoiseFault(nil)
+	serviceNoise.Name = "service-noise"
+	serviceNoise.Targets = []string{
+		db1.Name, db2.Name,
+		backendA.Name, backendB.Name, backendC.Name, backendD.Name, backendE.Name,
+	}
+	serviceNoise.Alarms = []string{"CPU", "Memory", "Disk"}
+	serviceNoise.Period = Exponential(30)
+	a.AddFault(serviceNoise)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterDataset("NoMeAcuerdoNiDeMiNombre", "Todos los servidores usan un DNS que se cae cada 4-8h, generando alarmas en todos sus clientes", NoMeAcuerdoNiDeMiNombre)
+}
+
+// NoMeAcuerdoNiDeMiNombre simula que se cae el servidor DNS y entonces muchos
+// servicios se ven afectados a la vez: todos los clientes levantan la alarma
+// DNS, los backends pierden la conexión con la DB y, si dependen de ellos,
+// también los frontends y el balanceador.
+func NoMeAcuerdoNiDeMiNombre(a *Architecture) {
+	// One service where the failures reach the balancer
+	db1 := a.NewDatabase("db1")
+	backendA := a.NewBackend("backendA", db1)
+	backendA.Transitive = true
+	frontendA1 := a.NewFrontend("frontendA1", backendA)
+	frontendA1.Transitive = true
+	frontendA2 := a.NewFrontend("frontendA2", backendA)
+	frontendA2.Transitive = true
+	a.NewLoadBalancer("lbA", frontendA1, frontendA2)
+
+	// Other services where the failures only reach the direct clients
+	db2 := a.NewDatabase("db2")
+	backendB := a.NewBackend("backendB", db2)
+	a.NewFrontend("frontendB1", backendB)
+	backendC := a.NewBackend("backendC", db2)
+	a.NewFrontend("frontendC1", backendC)
+
+	// Several servers as noise
+	noiseServers := []*Server{}
+	for i := 0; i < 30; i++ {
+		noiseServers = append(noiseServers, a.NewServer("noise"+fmt.Sprintf("%d", i)))
+	}
+
+	// DNS server used by all the servers
+	dns := a.NewDNS("dnsA")
+	for _, s := range a.GetAllServers() {
+		// Do not add the DNS server as a client to itself
+		if s.GetName() == dns.GetName() {
+			continue
+		}
+		dns.AddClient(s)
+	}
+
+	// Stop the DNS process each 4-8 hours for 10'
+	a.AddFault(&Fault{
+		Name:     "dnsA-down",
+		Target:   dns.Name,
+		Alarm:    "Proc",
+		Start:    Uniform(60, 4*60),
+		Duration: Constant(10),
+		Period:   Uniform(4*60, 8*60),
+	})
+
+	// Disconnect db2 once a day, so not every storm is caused by the DNS
+	a.AddFault(&Fault{
+		Name:     "db2-down",
+		Target:   db2.Name,
+		Alarm:    "Ping",
+		Start:    Uniform(6*60, 18*60),
+		Duration: Constant(10),
+		Period:   Constant(24 * 60),
+	})
+
+	// Generate alarm noise: each minute trigger one of the alarms of one of the noise servers
+	a.AddFault(NoiseFault(noiseServers))
+}
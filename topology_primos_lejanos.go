@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterDataset("PrimosLejanos", "Cadenas balanceador->frontend->backend->db donde la caída de la DB llega hasta el balanceador. Ruido en servidores conectados entre sí", PrimosLejanos)
+}
+
+// PrimosLejanos simula servicios donde, cuando se cae algo, el error se ve a
+// bastantes saltos de distancia.
+// Por ejemplo, se cae una DB y vemos el error en el balanceador
+// (balanceador->frontend->backend->db), porque los backends y frontends no
+// están disponibles mientras no lo está aquello de lo que dependen.
+// Los servidores de ruido también están interconectados, con alguna
+// relación topológica pero sin relación entre sus alarmas.
+func PrimosLejanos(a *Architecture) {
+	// First service: one frontend behind the balancer
+	db1 := a.NewDatabase("db1")
+	backendA := a.NewBackend("backendA", db1)
+	backendA.Transitive = true
+	frontendA1 := a.NewFrontend("frontendA1", backendA)
+	frontendA1.Transitive = true
+	a.NewLoadBalancer("lbA", frontendA1)
+
+	// Second service: two frontends of the same backend behind the balancer.
+	// The balancer only fails when both frontends are unavailable.
+	db2 := a.NewDatabase("db2")
+	backendB := a.NewBackend("backendB", db2)
+	backendB.Transitive = true
+	frontendB1 := a.NewFrontend("frontendB1", backendB)
+	frontendB1.Transitive = true
+	frontendB2 := a.NewFrontend("frontendB2", backendB)
+	frontendB2.Transitive = true
+	a.NewLoadBalancer("lbB", frontendB1, frontendB2)
+
+	// Noise servers interconnected: chains db->backend->frontend whose
+	// alarms are not related, and some isolated servers
+	noiseTargets := []string{}
+	for i := 0; i < 10; i++ {
+		db := a.NewDatabase(fmt.Sprintf("noisedb%d", i))
+		backend := a.NewBackend(fmt.Sprintf("noisebackend%d", i), db)
+		frontend := a.NewFrontend(fmt.Sprintf("noisefrontend%d", i), backend)
+		noiseTargets = append(noiseTargets, db.Name, backend.Name, frontend.Name)
+	}
+
+	noiseServers := []*Server{}
+	for i := 0; i < 20; i++ {
+		noiseServers = append(noiseServers, a.NewServer("noise"+fmt.Sprintf("%d", i)))
+	}
+
+	// Disconnect db1 about each 8 hours, for 10'
+	a.AddFault(&Fault{
+		Name:     "db1-down",
+		Target:   db1.Name,
+		Alarm:    "Ping",
+		Start:    Uniform(60, 8*60),
+		Duration: Constant(10),
+		Period:   Uniform(6*60, 10*60),
+	})
+
+	// Stop the database engine of db2 about each 12 hours, for 20'
+	a.AddFault(&Fault{
+		Name:     "db2-engine-down",
+		Target:   db2.Name,
+		Alarm:    "DBEngine",
+		Start:    Uniform(60, 12*60),
+		Duration: Constant(20),
+		Period:   Uniform(10*60, 14*60),
+	})
+
+	// Generate alarm noise in the isolated servers
+	a.AddFault(NoiseFault(noiseServers))
+
+	// And in the resources of the interconnected noise servers. Ping is not
+	// used because it would propagate to the connected servers.
+	chainNoise := NoiseFault(nil)
+	chainNoise.Name = "chain-noise"
+	chainNoise.Targets = noiseTargets
+	chainNoise.Alarms = []string{"CPU", "Memory", "Disk"}
+	chainNoise.Period = Constant(2)
+	a.AddFault(chainNoise)
+}
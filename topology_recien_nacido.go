@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+)
+
+func init() {
+	RegisterDataset("RecienNacido", "A mitad de la simulación se instalan una DB y su aplicación, que fallan juntas por primera vez. También se retiran servidores antiguos", RecienNacido)
+}
+
+// RecienNacido simula que vemos por primera vez la caída de un servicio y lo
+// que implica, sin histórico.
+// Al principio solo hay un servicio estable y ruido. A mitad del primer día
+// se instala un nuevo par de máquinas relacionadas (newdb y newapp, con su
+// frontend), y unas horas después se cae newdb y newapp se ve afectada, un
+// caso que nunca se había visto porque no existía.
+// Al final del primer día se retiran algunos servidores de ruido antiguos.
+func RecienNacido(a *Architecture) {
+	// The old, stable service
+	db1 := a.NewDatabase("db1")
+	backendA := a.NewBackend("backendA", db1)
+	a.NewFrontend("frontendA1", backendA)
+
+	// Several servers as noise, the legacy ones are removed later
+	noiseServers := []*Server{}
+	for i := 0; i < 20; i++ {
+		noiseServers = append(noiseServers, a.NewServer("noise"+fmt.Sprintf("%d", i)))
+	}
+	legacyServers := []*Server{}
+	for i := 0; i < 5; i++ {
+		legacyServers = append(legacyServers, a.NewServer("legacy"+fmt.Sprintf("%d", i)))
+	}
+
+	// db1 is disconnected once a day for 5', something already seen
+	a.AddFault(&Fault{
+		Name:     "db1-down",
+		Target:   db1.Name,
+		Alarm:    "Ping",
+		Start:    Uniform(60, 6*60),
+		Duration: Constant(5),
+		Period:   Constant(24 * 60),
+	})
+
+	// Generate alarm noise in the noise servers
+	a.AddFault(NoiseFault(noiseServers))
+
+	// Install the new pair of machines at 12h
+	a.At(12*60, func(a *Architecture) {
+		newdb := a.NewDatabase("newdb")
+		newapp := a.NewBackend("newapp", newdb)
+		newapp.Transitive = true
+		a.NewFrontend("newweb", newapp)
+
+		// The new database fails a few hours after the installation, and
+		// then every 12 hours
+		a.AddFault(&Fault{
+			Name:     "newdb-down",
+			Target:   newdb.Name,
+			Alarm:    "DBEngine",
+			Start:    Uniform(2*60, 6*60),
+			Duration: Constant(15),
+			Period:   Constant(12 * 60),
+		})
+	})
+
+	// Decommission the legacy servers at 24h
+	a.At(24*60, func(a *Architecture) {
+		for _, s := range legacyServers {
+			a.RemoveServer(s.Name)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopology(t *testing.T) {
+	mon := &fakeMonSys{}
+	a := Architecture{mon: mon}
+
+	topology := `
+databases:
+  - name: db1
+backends:
+  - name: backend1
+    database: db1
+frontends:
+  - name: frontend1
+    backend: backend1
+servers:
+  - name: noise
+    count: 3
+dns:
+  - name: dns1
+    all_clients: true
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+
+	assert.Len(t, a.Servers, 3)
+	assert.Equal(t, "noise2", a.Servers[2].Name)
+	assert.Len(t, a.DBs, 1)
+	assert.Len(t, a.Backends, 1)
+	assert.Equal(t, a.DBs[0], a.Backends[0].DBEngine)
+	assert.Len(t, a.Frontends, 1)
+	assert.Equal(t, a.Backends[0], a.Frontends[0].Backend)
+	assert.Len(t, a.DNSs, 1)
+	assert.Len(t, a.DNSs[0].Clients, 6)
+}
+
+func TestParseTopologyJSON(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `{
+  "databases": [{"name": "db1"}],
+  "backends": [{"name": "backend1", "database": "db1"}]
+}`
+	top, err := ParseTopology(strings.NewReader(topology), "test.json")
+	assert.NoError(t, err)
+	assert.NoError(t, top.Build(&a))
+
+	assert.Len(t, a.Backends, 1)
+	assert.Equal(t, "db1", a.Backends[0].DBEngine.Name)
+}
+
+func TestTopologyUnknownReference(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `databases:
+  - name: db1
+backends:
+  - name: backend1
+    database: db1
+  - name: backend2
+    database: db9
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:6: backend "backend2" references unknown database "db9"`)
+}
+
+func TestTopologyDuplicatedName(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `servers:
+  - name: srv1
+databases:
+  - name: srv1
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:4: duplicated name "srv1", already defined at line 2`)
+}
+
+func TestTopologyLoadBalancer(t *testing.T) {
+	a := Architecture{mon: &fakeMonSys{}}
+
+	topology := `databases:
+  - name: db1
+backends:
+  - name: backend1
+    database: db1
+    transitive: true
+frontends:
+  - name: frontend
+    count: 2
+    backend: backend1
+    transitive: true
+loadbalancers:
+  - name: lb1
+    frontends: [frontend0, frontend1]
+  - name: lb2
+    frontends: [frontend9]
+`
+	top, err := ParseTopology(strings.NewReader(topology), "test.yaml")
+	assert.NoError(t, err)
+	assert.EqualError(t, top.Build(&a), `test.yaml:15: load balancer "lb2" references unknown frontend "frontend9"`)
+
+	assert.True(t, a.Backends[0].Transitive)
+	assert.True(t, a.Frontends[1].Transitive)
+	assert.Len(t, a.LoadBalancers, 1)
+	assert.Equal(t, []*Frontend{a.Frontends[0], a.Frontends[1]}, a.LoadBalancers[0].Frontends)
+}
+
+// TestTopologyErrors checks that the invalid topologies are rejected with the
+// line of the wrong definition
+func TestTopologyErrors(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		topology string
+		err      string
+	}{
+		{
+			name: "kind without name",
+			topology: `kinds:
+  - alarms: [Lag]
+`,
+			err: `test.yaml:2: kind without name`,
+		},
+		{
+			name: "duplicated kind",
+			topology: `kinds:
+  - name: queue
+  - name: queue
+`,
+			err: `test.yaml:3: duplicated kind "queue", already defined at line 2`,
+		},
+		{
+			name: "kind available unless",
+			topology: `kinds:
+  - name: queue
+    alarms: [Lag]
+    available_unless: [Proc]
+`,
+			err: `test.yaml:2: kind "queue" available unless unknown alarm "Proc"`,
+		},
+		{
+			name: "cluster quorum",
+			topology: `servers:
+  - name: zk0
+clusters:
+  - name: wrong
+    members: [zk0]
+    quorum: 2
+`,
+			err: `test.yaml:4: cluster "wrong" quorum 2 should be between 0 and its 1 members`,
+		},
+		{
+			name: "empty cluster",
+			topology: `clusters:
+  - name: c1
+    quorum: 0
+    members: []
+`,
+			err: `test.yaml:2: cluster "c1" without members`,
+		},
+		{
+			name: "deployment node",
+			topology: `kube_nodes:
+  - name: node
+    count: 2
+deployments:
+  - name: api
+    replicas: 1
+    nodes: [node1, node7]
+`,
+			err: `test.yaml:5: deployment "api" references unknown node "node7"`,
+		},
+		{
+			name: "guest twice",
+			topology: `servers:
+  - name: web1
+hypervisors:
+  - name: esx
+    guests: [web1]
+  - name: dbhost
+    guests: [web1]
+`,
+			err: `test.yaml:6: guest "web1" already runs on hypervisor "esx"`,
+		},
+		{
+			name: "unknown guest",
+			topology: `hypervisors:
+  - name: esx
+    guests: [web9]
+`,
+			err: `test.yaml:2: hypervisor "esx" references unknown guest "web9"`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			top, err := ParseTopology(strings.NewReader(c.topology), "test.yaml")
+			assert.NoError(t, err)
+			assert.EqualError(t, top.Build(&Architecture{mon: &fakeMonSys{}}), c.err)
+		})
+	}
+}